@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,11 +12,20 @@ import (
 	"github.com/slvic/stock-observer/internal/app"
 )
 
+var validate = flag.Bool("validate", false, "validate the config, probe every market once and exit")
+
 func run(ctx context.Context) error {
 	newApp, err := app.Initialize(ctx)
 	if err != nil {
 		return err
 	}
+	if *validate {
+		return newApp.Validate(ctx)
+	}
+	if flag.Arg(0) == "verify" {
+		return newApp.Verify(ctx)
+	}
+	go reloadOnHangup(ctx, newApp)
 	err = newApp.Run(ctx)
 	if err != nil {
 		return err
@@ -22,10 +33,29 @@ func run(ctx context.Context) error {
 	return nil
 }
 
+// reloadOnHangup reloads the config on every SIGHUP until ctx is done
+func reloadOnHangup(ctx context.Context, newApp *app.App) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-hangup:
+			if err := newApp.Reload(); err != nil {
+				slog.Error("could not reload the config", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
+	flag.Parse()
 	if err := run(ctx); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "app run: %s\n", err.Error())
+		os.Exit(1)
 	}
 }
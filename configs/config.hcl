@@ -1,9 +1,276 @@
+# STOCK_OBSERVER_CONFIG points to another config file; these environment
+# variables take precedence over it: SCRAPE_INTERVAL (hours or e.g. 2h),
+# LOG_LEVEL, LOG_FORMAT, STORAGE_DSN, METRICS_ADDRESS, BINANCE_ADDRESS,
+# BINANCE_ADDRESSES, BINANCE_ASSETS and BINANCE_FIATS (comma separated),
+# BINANCE_PROXY, BINANCE_API_KEY, BINANCE_API_SECRET, BESTCHANGE_API_URL and
+# BESTCHANGE_PROXY; each of them may be
+# given as NAME_FILE, the path of a file holding the value, e.g. a mounted secret
+#
+# SIGHUP re-reads this file, the binance assets, fiats and pairs and the fetch
+# interval are swapped from the next scrape on and every other setting needs a restart
+
 app {
   fetchIntervalInHours = 1
+  # a scrape of a market running longer is abandoned and counted in
+  # scrape_timeouts_total, 0 lets it run until it is done
+  scrapeTimeoutInSeconds = 0
+  # scrape the markets one after another instead of all at once, the ones
+  # listed in marketPriority first and in that order
+  sequentialMarkets = false
+  marketPriority = []
+  # a scrape running longer than the interval skips the missed ticks
+  # instead of starting the next scrape right away
+  skipOverlapping = false
+  # start with a larger interval and ramp it down to fetchIntervalInHours
+  # over rampUpCycles cycles, 0 cycles disables the ramp
+  rampStartIntervalInHours = 0
+  rampUpCycles = 0
+  # help text overrides by full metric name, e.g. binance_price_zscore
+  metricHelp = {}
+  # debug, info, warn or error; text or json
+  logLevel = "info"
+  logFormat = "text"
+  # sqlite database every binance ad and bestchange rate is stored in,
+  # e.g. "file:observer.db?_journal_mode=WAL", nothing is stored when empty
+  storageDSN = ""
+  # rows written per transaction, binance offers are written as soon as a batch
+  # is gathered instead of at the end of the scrape, defaults to 1000
+  storageBatchSize = 1000
+
+  # the http server of /metrics, /healthz, /readyz and /api/v1/binance,
+  # address is host:port or unix:/path/to/socket; disabled drops the
+  # metrics endpoint while the server keeps serving the others
+  metrics {
+    address = ":8080"
+    path = "/metrics"
+    disabled = false
+  }
+  # serves the latest binance snapshots and bestchange rates over grpc, see
+  # pkg/observerpb/observer.proto; address is host:port or unix:/path/to/socket
+  # grpc {
+  #   address = ":9090"
+  # }
 }
 
 binance {
   address = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search"
+  # tried in order when a request to address fails
+  fallbackAddresses = []
+  # endpoints tried in order, replaces address and fallbackAddresses when set;
+  # binance_endpoint_requests_total counts the requests served by each of them
+  addresses = []
+  # endpoint blocks replace address, fallbackAddresses and addresses when set,
+  # requests to an endpoint with sign = true carry a timestamp, an HMAC-SHA256
+  # signature made with apiSecret and apiKey in the X-MBX-APIKEY header
+  # endpoint {
+  #   address = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search"
+  #   sign    = true
+  # }
+  apiKey    = ""
+  apiSecret = ""
+  # signed requests are accepted for this many seconds after their timestamp,
+  # up to 60; 0 leaves recvWindow out and binance applies its default of 5
+  recvWindowInSeconds = 0
+  # the offset to the binance server time is measured at startup, added to the
+  # timestamp of signed requests and exported as binance_clock_skew_seconds
+  # serverTimeAddress = "https://api.binance.com/api/v3/time"
+  # http(s) or socks5 proxy url of every request, e.g. "socks5://127.0.0.1:1080",
+  # HTTP_PROXY and HTTPS_PROXY are used when empty
+  proxy = ""
+  requestIdHeader = "X-Request-Id"
+  # sent with every request, e.g. a browser-like user agent or cookies,
+  # headers of a named client take precedence
+  # userAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0"
+  headers = {}
+  # a first page without ads is requested again up to this many times
+  retryOnEmpty = 0
+  # body-level error codes that are retried although the http status is 200,
+  # "000000" is success; errorCodeRetries defaults to 2 when codes are set,
+  # a retry waits with the backoff of baseDelayInMilliseconds below
+  retryErrorCodes = []
+  errorCodeRetries = 2
+  # retries of 429, 5xx and timed out requests with exponential backoff,
+  # a Retry-After header on 429 is honored up to maxDelayInMilliseconds,
+  # 0 does not retry; a request makes maxRetries+1 attempts across the
+  # addresses, at least one at each of them
+  maxRetries = 0
+  baseDelayInMilliseconds = 500
+  maxDelayInMilliseconds = 10000
+  # ads requested per page, binance answers at most 20
+  rows = 20
+  # pages of rows ads requested per side until an empty or short page
+  maxPages = 1
+  # binance requests in flight at once, defaults to 8
+  maxConcurrency = 8
+  # pages of a side requested at once, the pairs requested at once are cut to
+  # maxConcurrency / pageConcurrency so that the requests in flight stay within
+  # maxConcurrency; 1 requests the pages one after another
+  pageConcurrency = 1
+  # requests sent per second on average with up to burst at once, retries
+  # included; 0 does not limit the rate
+  requestsPerSecond = 0
+  burst = 1
+  # a scrape with more failed requests than this percent is reported as failed
+  maxFailedPercent = 50
+  # make sure the endpoint accepts Content-Encoding: gzip before enabling
+  gzipRequests = false
+  # request merchant ads only (default) or every advertiser, merchantBoth requests
+  # both and tells them apart by the merchant label, doubling the series count
+  merchantOnly = true
+  merchantBoth = false
+  # publish a pair only when both BUY and SELL were scraped in the cycle
+  completePairsOnly = false
+  # while a side keeps failing binance_last_price keeps its last known value
+  # labelled stale="true", it is back to stale="false" after a successful scrape
+  staleOnFailure = false
+  # count advertisers posting on both sides of a pair in
+  # binance_two_sided_advertiser_count, excludeTwoSided also drops their offers
+  detectTwoSided = false
+  excludeTwoSided = false
+  # expose binance_mid_price from the best BUY and SELL prices of each pair
+  # midPrice = true
+  # expose binance_spread, the best SELL minus the best BUY price of each pair
+  # spread = true
+  # binance_spread is only exported while both sides of a pair were scraped
+  # within this many milliseconds, binance_spread_stale is 1 otherwise; 0 always
+  # exports it
+  spreadToleranceInMilliseconds = 0
+  bestN = 5
+  # a side scraped with fewer offers than this is not published in the price
+  # metrics and binance_low_liquidity is 1 for it, 0 publishes every side
+  minOffersToPublish = 0
+  # share of the cheapest and of the most expensive offers dropped from the trimmed mean
+  trimFraction = 0.1
+  # offer ranks compared to the best offer in binance_offer_decay_percent
+  decayRanks = [5, 10]
+  # per-scrape price percentiles exported as binance_price_p50 and so on
+  percentiles = [50, 90]
+  # percent from the best price the tradable quantity is summed within
+  liquidityBands = [0.5, 1, 2]
+  # recent offers per series the price/quantity correlation is computed over,
+  # it is not exported until 10 offers are seen
+  correlationWindow = 500
+  # best price of a scrape is compared to the previous zScoreWindow scrapes,
+  # binance_price_zscore is not exported until 10 scrapes are seen and
+  # scrapes beyond zScoreThreshold are counted in binance_price_anomalies_total
+  zScoreWindow = 100
+  zScoreThreshold = 3
+  # payment method identifiers counted in binance_method_offer_count
+  payMethods = [
+    "TinkoffNew",
+    "RosBankNew",
+    "QIWI",
+  ]
+  # request only ads accepting these pay types, they are the payType label;
+  # splitByPayType requests every pay type on its own, multiplying the series
+  # count by the number of pay types
+  payTypes = []
+  splitByPayType = false
+
+  # fiat to the currencyGroup label, unlisted fiats get defaultCurrencyGroup
+  currencyGroups = {
+    RUB = "CIS"
+    KZT = "CIS"
+    UAH = "CIS"
+    AMD = "CIS"
+    AZN = "CIS"
+    GEL = "CIS"
+    KGS = "CIS"
+    MDL = "CIS"
+    TJS = "CIS"
+    TMT = "CIS"
+    UZS = "CIS"
+    EUR = "EUR"
+    USD = "USD"
+  }
+  defaultCurrencyGroup = "other"
+
+  # request timeout of multiplier times the recent median latency within
+  # [minInSeconds, maxInSeconds], the client timeout applies when unset
+  # adaptiveTimeout {
+  #   multiplier = 4
+  #   minInSeconds = 5
+  #   maxInSeconds = 30
+  # }
+
+  # a pair failing failureThreshold cycles in a row is not requested
+  # until cooldownInSeconds have passed
+  # pairCircuit {
+  #   failureThreshold = 5
+  #   cooldownInSeconds = 21600
+  # }
+
+  # samples {
+  #   path = "samples/binance.jsonl"
+  #   maxSizeInMegabytes = 100
+  #   maxAgeInHours = 24
+  #   gzipRotated = true
+  # }
+
+  # scrape every asset binance lists as tradable for a fiat in addition to assets,
+  # each added asset multiplies the exported series by the number of fiats
+  # discovery {
+  #   intervalInHours = 24
+  #   regex = "USDT|BTC|ETH|.*USD.*"
+  #   maxAssets = 20
+  # }
+
+  # export binance_price, binance_tradableQuantity and binance_commissionRate
+  # as histograms instead of summaries; every bucket is a series per label set,
+  # so the series count grows by the bucket count times tradeTypes*assets*fiats
+  # histograms {
+  #   priceBuckets = [50, 60, 70, 80, 90, 100, 110, 120]
+  #   tradableQuantityBuckets = []
+  #   commissionRateBuckets = []
+  #   # also export native histograms, scraped by a prometheus with the
+  #   # native-histograms feature; each bucket is up to nativeBucketFactor wider
+  #   # than the previous one and a label set keeps at most nativeMaxBuckets
+  #   # buckets, 160 by default
+  #   nativeBucketFactor = 1.1
+  #   nativeMaxBuckets = 160
+  # }
+
+  # tune rows of pairs without a rows override to the cycle duration,
+  # the current value is exposed as binance_rows
+  # adaptiveRows {
+  #   minRows = 10
+  #   maxRows = 20
+  #   budgetInSeconds = 60
+  # }
+
+  # named http clients, a pair uses one with `client = "name"`,
+  # pairs without a client share the default one
+  # client {
+  #   name = "proxied"
+  #   timeoutInSeconds = 30
+  #   proxy = "http://proxy.local:3128"
+  #   headers = {}
+  # }
+
+  # settings of a single asset/fiat pair, rows overrides the ads requested per page,
+  # up to 20, and pairs with a higher priority are requested first
+  # pair {
+  #   asset = "USDT"
+  #   fiat = "RUB"
+  #   rows = 10
+  #   priority = 10
+  # }
+
+  # ads of a pair priced outside of the band are dropped and counted
+  # priceBand {
+  #   asset = "USDT"
+  #   fiat = "RUB"
+  #   minPrice = 10
+  #   maxPrice = 1000
+  # }
+
+  # relabel {
+  #   action = "replace"
+  #   sourceLabel = "fiat"
+  #   regex = "BIF|KMF|PGK"
+  #   targetLabel = "fiat"
+  #   replacement = "other"
+  # }
 
   assets = [
      "USDT",
@@ -120,4 +387,71 @@ binance {
 bestchange {
   baseurl = "https://www.bestchange.com/"
   apiurl = "http://api.bestchange.ru/info.zip"
+  # api parts downloaded and extracted in parallel, apiurl alone when empty
+  apiUrls = []
+  # http(s) or socks5 proxy url, HTTP_PROXY and HTTPS_PROXY are used when empty
+  proxy = ""
+  # where the api zip is downloaded to and extracted, relative to the working
+  # directory; further apiUrls parts get a numbered zip file and extraction
+  # directory, a currency or exchanger id named by several parts keeps the name
+  # of the first part listing it
+  zipFile = "bestChange.zip"
+  extractDir = "bestChange"
+  # extracted files are reused while the api answers 304 Not Modified, but
+  # downloaded again once they are older than this
+  maxExtractAgeInHours = 6
+
+  # adaptiveTimeout {
+  #   multiplier = 3
+  #   minInSeconds = 15
+  #   maxInSeconds = 120
+  # }
+
+  # rates outside of the bounds are dropped, a zero bound is not checked
+  # rateBounds {
+  #   minGiveRate = 0.000000001
+  #   maxGiveRate = 1000000000
+  #   minGetRate = 0.000000001
+  #   maxGetRate = 1000000000
+  # }
+
+  # ids from bm_cy.dat, both currencies of a rate must be listed, empty means all
+  currencyIds = []
+
+  # exchanger and currency names mapped to fixed label values,
+  # anything else is transliterated
+  labels = {}
+  # iuliia scheme of the transliteration: wikipedia (default), icao_doc_9303,
+  # gost_52535, gost_7034, mosmetro, scientific, telegram, yandex_money
+  # or none for names that are already latin
+  transliteration = "wikipedia"
+
+  # only rates of the listed pairs are exported, every pair when none is listed;
+  # names are as in bm_cy.dat or the name of a merge
+  # pair {
+  #   source = "Bitcoin (BTC)"
+  #   target = "Сбербанк RUB"
+  # }
+
+  # bestchange_best_exchanger is 1 for the exchanger with the best rate of each
+  # listed pair, the previous winner's series is removed when it changes
+  # bestExchanger {
+  #   source = "Tether TRC20 (USDT)"
+  #   target = "Сбербанк RUB"
+  # }
+
+  # rates of the listed currency ids are reported under one canonical name,
+  # this changes series identity: the per-id series are no longer exported
+  # merge {
+  #   name = "Tether USDT"
+  #   currencyIds = [10, 36, 208]
+  # }
+}
+
+# thresholds checked by `stock-observer verify`, zero means not checked
+verify {
+  minOffers = 5
+  minPrice = 0
+  maxPrice = 0
+  minBestchangeRates = 1000
 }
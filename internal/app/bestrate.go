@@ -0,0 +1,132 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/bestchange/api"
+	"github.com/slvic/stock-observer/pkg/markets/binance"
+)
+
+const (
+	buySide  = "buy"
+	sellSide = "sell"
+)
+
+func init() {
+	prometheus.MustRegister(bestAvailableRate)
+}
+
+var bestAvailableRate = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "best_available_rate",
+		Help: "Best rate of a pair across the markets, in fiat per asset unit, labelled with the market offering it; buy is the lowest price of the asset and sell the highest.",
+	},
+	[]string{"asset", "fiat", "side", "source"},
+)
+
+// bestAvailable remembers the winning market of every pair and side
+// so its series is removed once another market wins
+type bestAvailable struct {
+	mu      sync.Mutex
+	winners map[[3]string]string
+}
+
+func newBestAvailable() *bestAvailable {
+	return &bestAvailable{winners: make(map[[3]string]string)}
+}
+
+// pairSnapshots are the latest binance observations by pair
+type pairSnapshots interface {
+	Pairs() []configs.Pair
+	Snapshot(asset, fiat string) (binance.Snapshot, bool)
+}
+
+// codeRates are the latest bestchange rates by currency code
+type codeRates interface {
+	LatestRate(source, target string) (api.CodeRate, bool)
+}
+
+// candidate is the best rate of a side of a pair on a market
+type candidate struct {
+	source string
+	rate   float64
+}
+
+// binanceCandidates returns the best binance price of each side of the snapshot
+func binanceCandidates(snapshot binance.Snapshot) map[string]candidate {
+	candidates := make(map[string]candidate, 2)
+	for _, observation := range snapshot.Observations {
+		side := buySide
+		if observation.TradeType == "SELL" {
+			side = sellSide
+		}
+		best, ok := candidates[side]
+		if !ok || better(side, observation.BestPrice, best.rate) {
+			candidates[side] = candidate{source: "binance", rate: observation.BestPrice}
+		}
+	}
+	return candidates
+}
+
+// bestchangeCandidates returns the bestchange rate of each side of the pair,
+// buying gives fiat for the asset and selling the other way around
+func bestchangeCandidates(bestchange codeRates, asset, fiat string) map[string]candidate {
+	candidates := make(map[string]candidate, 2)
+	if rate, ok := bestchange.LatestRate(fiat, asset); ok && rate.Rate > 0 {
+		candidates[buySide] = candidate{source: "bestchange", rate: 1 / rate.Rate}
+	}
+	if rate, ok := bestchange.LatestRate(asset, fiat); ok && rate.Rate > 0 {
+		candidates[sellSide] = candidate{source: "bestchange", rate: rate.Rate}
+	}
+	return candidates
+}
+
+// better reports whether rate beats best on the side, a buyer pays less fiat
+// per asset and a seller gets more
+func better(side string, rate, best float64) bool {
+	if side == buySide {
+		return rate < best
+	}
+	return rate > best
+}
+
+// observeBestAvailable publishes the best rates once every market is scraped
+func (a *App) observeBestAvailable() {
+	if a.binance == nil || a.bestchange == nil {
+		return
+	}
+	a.bestAvailable.observe(a.binance, a.bestchange)
+}
+
+// observe publishes the best rate of every binance pair across binance
+// and bestchange, a pair with data on a single market takes it
+func (b *bestAvailable) observe(snapshots pairSnapshots, rates codeRates) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pair := range snapshots.Pairs() {
+		candidates := bestchangeCandidates(rates, pair.Asset, pair.Fiat)
+		if snapshot, ok := snapshots.Snapshot(pair.Asset, pair.Fiat); ok {
+			for side, binanceBest := range binanceCandidates(snapshot) {
+				if best, ok := candidates[side]; !ok || better(side, binanceBest.rate, best.rate) {
+					candidates[side] = binanceBest
+				}
+			}
+		}
+		for _, side := range []string{buySide, sellSide} {
+			key := [3]string{pair.Asset, pair.Fiat, side}
+			previous, hadWinner := b.winners[key]
+			best, ok := candidates[side]
+			if hadWinner && (!ok || previous != best.source) {
+				bestAvailableRate.DeleteLabelValues(pair.Asset, pair.Fiat, side, previous)
+				delete(b.winners, key)
+			}
+			if !ok {
+				continue
+			}
+			bestAvailableRate.WithLabelValues(pair.Asset, pair.Fiat, side, best.source).Set(best.rate)
+			b.winners[key] = best.source
+		}
+	}
+}
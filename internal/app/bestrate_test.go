@@ -0,0 +1,102 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/bestchange/api"
+	"github.com/slvic/stock-observer/pkg/markets/binance"
+)
+
+type fakeSnapshots map[string]binance.Snapshot
+
+func (s fakeSnapshots) Pairs() []configs.Pair {
+	return []configs.Pair{{Asset: "USDT", Fiat: "RUB"}}
+}
+
+func (s fakeSnapshots) Snapshot(asset, fiat string) (binance.Snapshot, bool) {
+	snapshot, ok := s[asset+"/"+fiat]
+	return snapshot, ok
+}
+
+type fakeRates map[[2]string]float64
+
+func (r fakeRates) LatestRate(source, target string) (api.CodeRate, bool) {
+	rate, ok := r[[2]string{source, target}]
+	return api.CodeRate{Source: source, Target: target, Rate: rate}, ok
+}
+
+// binanceSnapshot is a USDT/RUB snapshot with the best buy and sell prices
+func binanceSnapshot(buy, sell float64) fakeSnapshots {
+	return fakeSnapshots{"USDT/RUB": {Asset: "USDT", Fiat: "RUB", Observations: []binance.Observation{
+		{TradeType: "BUY", BestPrice: buy + 1},
+		{TradeType: "BUY", BestPrice: buy},
+		{TradeType: "SELL", BestPrice: sell},
+		{TradeType: "SELL", BestPrice: sell - 1},
+	}}}
+}
+
+// publishedBestRates returns the USDT/RUB best_available_rate series by side and source
+func publishedBestRates(t *testing.T) map[[2]string]float64 {
+	t.Helper()
+	metrics := make(chan prometheus.Metric, 16)
+	bestAvailableRate.Collect(metrics)
+	close(metrics)
+	published := make(map[[2]string]float64)
+	for metric := range metrics {
+		var written dto.Metric
+		if err := metric.Write(&written); err != nil {
+			t.Fatalf("could not write a metric: %s", err.Error())
+		}
+		labels := make(map[string]string)
+		for _, label := range written.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["asset"] == "USDT" && labels["fiat"] == "RUB" {
+			published[[2]string{labels["side"], labels["source"]}] = written.GetGauge().GetValue()
+		}
+	}
+	return published
+}
+
+func TestBestAvailable(t *testing.T) {
+	steps := []struct {
+		name      string
+		snapshots fakeSnapshots
+		rates     fakeRates
+		want      map[[2]string]float64
+	}{
+		{
+			name:      "binance only",
+			snapshots: binanceSnapshot(90, 89),
+			want:      map[[2]string]float64{{buySide, "binance"}: 90, {sellSide, "binance"}: 89},
+		},
+		{
+			name:      "bestchange buys cheaper",
+			snapshots: binanceSnapshot(90, 89),
+			// 1/80 USDT per RUB is 80 RUB per USDT
+			rates: fakeRates{{"RUB", "USDT"}: 1.0 / 80, {"USDT", "RUB"}: 85},
+			want:  map[[2]string]float64{{buySide, "bestchange"}: 80, {sellSide, "binance"}: 89},
+		},
+		{
+			name:  "bestchange only",
+			rates: fakeRates{{"USDT", "RUB"}: 85},
+			want:  map[[2]string]float64{{sellSide, "bestchange"}: 85},
+		},
+		{
+			name: "no data",
+			want: map[[2]string]float64{},
+		},
+	}
+	// the steps run in order, every step replaces the winners of the previous one
+	best := newBestAvailable()
+	for _, step := range steps {
+		best.observe(step.snapshots, step.rates)
+		if got := publishedBestRates(t); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got best rates %v, want %v", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/slvic/stock-observer/pkg/bestchange/api"
+	"github.com/slvic/stock-observer/pkg/markets/binance"
+	"github.com/slvic/stock-observer/pkg/observerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// observerServer serves the latest data of every market and pushes it to
+// the subscribers after every scrape
+type observerServer struct {
+	observerpb.UnimplementedObserverServer
+	latest func() *observerpb.Latest
+
+	mu          sync.Mutex
+	subscribers map[chan *observerpb.Latest]struct{}
+}
+
+func newObserverServer(latest func() *observerpb.Latest) *observerServer {
+	return &observerServer{
+		latest:      latest,
+		subscribers: make(map[chan *observerpb.Latest]struct{}),
+	}
+}
+
+func (s *observerServer) GetLatest(context.Context, *observerpb.GetLatestRequest) (*observerpb.Latest, error) {
+	return s.latest(), nil
+}
+
+// Subscribe sends the latest data and then every published one until the
+// client goes away, a client that has not taken the previous data when the
+// next is published only gets the next one
+func (s *observerServer) Subscribe(_ *observerpb.SubscribeRequest, stream observerpb.Observer_SubscribeServer) error {
+	updates := make(chan *observerpb.Latest, 1)
+	updates <- s.latest()
+	s.mu.Lock()
+	s.subscribers[updates] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, updates)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case latest := <-updates:
+			if err := stream.Send(latest); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// publish hands the latest data to every subscriber without waiting for them,
+// data a subscriber has not taken yet is replaced
+func (s *observerServer) publish() {
+	latest := s.latest()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for updates := range s.subscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- latest
+	}
+}
+
+// latestData converts the binance snapshots and bestchange rates into the grpc message
+func latestData(snapshots []binance.Snapshot, rates []api.CodeRate) *observerpb.Latest {
+	latest := &observerpb.Latest{
+		Binance:     make([]*observerpb.BinanceSnapshot, 0, len(snapshots)),
+		Bestchange:  make([]*observerpb.BestchangeRate, 0, len(rates)),
+		PublishedAt: timestamppb.Now(),
+	}
+	for _, snapshot := range snapshots {
+		pair := &observerpb.BinanceSnapshot{
+			Asset:        snapshot.Asset,
+			Fiat:         snapshot.Fiat,
+			Observations: make([]*observerpb.BinanceObservation, 0, len(snapshot.Observations)),
+		}
+		for _, observation := range snapshot.Observations {
+			pair.Observations = append(pair.Observations, &observerpb.BinanceObservation{
+				TradeType: observation.TradeType,
+				Merchant:  observation.Merchant,
+				PayType:   observation.PayType,
+				BestPrice: observation.BestPrice,
+				Offers:    int32(observation.Offers),
+				UpdatedAt: timestamppb.New(observation.UpdatedAt),
+			})
+		}
+		latest.Binance = append(latest.Binance, pair)
+	}
+	for _, rate := range rates {
+		latest.Bestchange = append(latest.Bestchange, &observerpb.BestchangeRate{
+			Source:    rate.Source,
+			Target:    rate.Target,
+			Rate:      rate.Rate,
+			Exchanger: rate.Exchanger,
+			UpdatedAt: timestamppb.New(rate.UpdatedAt),
+		})
+	}
+	return latest
+}
+
+// latest returns the latest data of both markets
+func (a *App) latest() *observerpb.Latest {
+	return latestData(a.binance.Snapshots(), a.bestchange.LatestRates())
+}
+
+// startGrpcServer serves the latest data on the grpc address, like the
+// metrics gatherer a failure to listen or serve stops the app
+func (a *App) startGrpcServer(cancel context.CancelFunc) {
+	listener, err := listen(a.config.Grpc.Address)
+	if err != nil {
+		a.logger.Error("could not start a grpc server", "address", a.config.Grpc.Address, "err", err)
+		cancel()
+		return
+	}
+	server := grpc.NewServer()
+	observerpb.RegisterObserverServer(server, a.observer)
+	a.logger.Info("serving grpc", "address", a.config.Grpc.Address)
+	if err = server.Serve(listener); err != nil {
+		a.logger.Error("could not serve grpc", "err", err)
+		cancel()
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/pkg/bestchange/api"
+	"github.com/slvic/stock-observer/pkg/markets/binance"
+	"github.com/slvic/stock-observer/pkg/observerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestObserver serves an observer publishing the number of publishes as
+// the rate of a single bestchange rate and returns a client of it
+func newTestObserver(t *testing.T) (*observerServer, observerpb.ObserverClient) {
+	t.Helper()
+	var published atomic.Int32
+	observer := newObserverServer(func() *observerpb.Latest {
+		rate := api.CodeRate{Source: "RUB", Target: "USDT", Rate: float64(published.Add(1))}
+		return latestData(nil, []api.CodeRate{rate})
+	})
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	observerpb.RegisterObserverServer(server, observer)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("could not dial the observer: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return observer, observerpb.NewObserverClient(conn)
+}
+
+// latestRate is the rate of the single bestchange rate of the latest data
+func latestRate(t *testing.T, latest *observerpb.Latest) float64 {
+	t.Helper()
+	if len(latest.GetBestchange()) != 1 {
+		t.Fatalf("got %d bestchange rates, want 1", len(latest.GetBestchange()))
+	}
+	return latest.GetBestchange()[0].GetRate()
+}
+
+// subscribers returns the number of subscribed streams
+func subscribers(observer *observerServer) int {
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	return len(observer.subscribers)
+}
+
+// waitFor polls until the condition holds or a second is over
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestObserverGetLatest(t *testing.T) {
+	_, client := newTestObserver(t)
+
+	latest, err := client.GetLatest(context.Background(), &observerpb.GetLatestRequest{})
+	if err != nil {
+		t.Fatalf("could not get the latest data: %s", err.Error())
+	}
+	if got := latestRate(t, latest); got != 1 {
+		t.Errorf("got rate %v, want 1", got)
+	}
+}
+
+func TestObserverSubscribe(t *testing.T) {
+	observer, client := newTestObserver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &observerpb.SubscribeRequest{})
+	if err != nil {
+		t.Fatalf("could not subscribe: %s", err.Error())
+	}
+	latest, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("could not receive the current data: %s", err.Error())
+	}
+	if got := latestRate(t, latest); got != 1 {
+		t.Errorf("got rate %v on subscribing, want 1", got)
+	}
+	waitFor(t, "the subscription", func() bool { return subscribers(observer) == 1 })
+
+	observer.publish()
+	if latest, err = stream.Recv(); err != nil {
+		t.Fatalf("could not receive a published update: %s", err.Error())
+	}
+	if got := latestRate(t, latest); got != 2 {
+		t.Errorf("got rate %v after a publish, want 2", got)
+	}
+
+	cancel()
+	waitFor(t, "the subscriber to leave", func() bool { return subscribers(observer) == 0 })
+}
+
+func TestObserverPublishSlowSubscriber(t *testing.T) {
+	observer := newObserverServer(func() *observerpb.Latest { return &observerpb.Latest{} })
+	updates := make(chan *observerpb.Latest, 1)
+	observer.subscribers[updates] = struct{}{}
+
+	var latest *observerpb.Latest
+	observer.latest = func() *observerpb.Latest {
+		latest = &observerpb.Latest{}
+		return latest
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			observer.publish()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("publish blocked on a subscriber not taking the updates")
+	}
+	if got := <-updates; got != latest {
+		t.Errorf("got an older update, want the last one published")
+	}
+}
+
+func TestLatestData(t *testing.T) {
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	latest := latestData(
+		[]binance.Snapshot{{Asset: "USDT", Fiat: "RUB", Observations: []binance.Observation{
+			{TradeType: "BUY", Merchant: true, BestPrice: 90, Offers: 3, UpdatedAt: updatedAt},
+		}}},
+		[]api.CodeRate{{Source: "RUB", Target: "USDT", Rate: 0.01, Exchanger: "fast", UpdatedAt: updatedAt}},
+	)
+	observation := latest.GetBinance()[0].GetObservations()[0]
+	if observation.GetBestPrice() != 90 || observation.GetOffers() != 3 || !observation.GetUpdatedAt().AsTime().Equal(updatedAt) {
+		t.Errorf("got observation %v", observation)
+	}
+	rate := latest.GetBestchange()[0]
+	if rate.GetExchanger() != "fast" || rate.GetRate() != 0.01 || !rate.GetUpdatedAt().AsTime().Equal(updatedAt) {
+		t.Errorf("got rate %v", rate)
+	}
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// health tracks the last successful scrape of every source for /readyz
+type health struct {
+	mu          sync.Mutex
+	sources     []string
+	interval    time.Duration
+	lastSuccess map[string]time.Time
+}
+
+func newHealth(sources []string) *health {
+	return &health{
+		sources:     sources,
+		lastSuccess: make(map[string]time.Time, len(sources)),
+	}
+}
+
+func (h *health) setInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.interval = interval
+}
+
+func (h *health) success(source string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSuccess[source] = time.Now()
+}
+
+// ready is an error until every source succeeded once
+// and while no source succeeded within two intervals
+func (h *health) ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var latest time.Time
+	for _, source := range h.sources {
+		lastSuccess, ok := h.lastSuccess[source]
+		if !ok {
+			return fmt.Errorf("%s has not been scraped yet", source)
+		}
+		if lastSuccess.After(latest) {
+			latest = lastSuccess
+		}
+	}
+	if h.interval > 0 && time.Since(latest) > 2*h.interval {
+		return fmt.Errorf("no source succeeded since %s", latest.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+func (h *health) readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	if err := h.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -2,23 +2,35 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/logging"
+	"github.com/slvic/stock-observer/internal/storage"
+	"github.com/slvic/stock-observer/internal/version"
 	"github.com/slvic/stock-observer/pkg/bestchange/api"
+	"github.com/slvic/stock-observer/pkg/markets"
 	"github.com/slvic/stock-observer/pkg/markets/binance"
 )
 
 const (
 	defaultConfigPath = "configs/config.hcl"
-	currentLocation   = "Europe/Moscow"
+	// the http server of the metrics, health and snapshot endpoints
+	defaultMetricsAddress = ":8080"
+	defaultMetricsPath    = "/metrics"
+	currentLocation       = "Europe/Moscow"
 )
 
 func init() {
@@ -26,48 +38,143 @@ func init() {
 	if err != nil {
 		log.Fatal("could not set TZ env variable")
 	}
+	prometheus.MustRegister(buildInfo)
+	prometheus.MustRegister(scrapeInterval)
+	prometheus.MustRegister(scrapeTimeouts)
 }
 
+var (
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stock_observer_build_info",
+			Help: "Build information of the running binary, always 1.",
+		},
+		[]string{"version", "commit", "buildDate"},
+	)
+	scrapeInterval = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scrape_interval_seconds",
+			Help: "Interval between scrapes of a market, in seconds.",
+		},
+		[]string{"market"},
+	)
+	scrapeTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scrape_timeouts_total",
+			Help: "Scrapes of a market abandoned after the scrape timeout.",
+		},
+		[]string{"market"},
+	)
+)
+
 type App struct {
 	bestchange *api.Bestchange
 	binance    *binance.Binance
-	config     configs.App
+	sources    []markets.MarketSource
+	health     *health
+	// winners of best_available_rate
+	bestAvailable *bestAvailable
+	// grpc server of the latest data, nil unless app.grpc is set
+	observer *observerServer
+	config   configs.App
+	// guards the interval settings of config and the current cycle
+	intervalMu sync.Mutex
+	cycle      int
+	logger     *slog.Logger
+	store      *storage.Store
+	verify     configs.Verify
 }
 
 func Initialize(ctx context.Context) (*App, error) {
-	config, err := configs.GetConfig(defaultConfigPath)
+	config, err := configs.Load(defaultConfigPath, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("could not get config: %w", err)
+	}
+	logger, err := logging.New(os.Stderr, config.App.LogLevel, config.App.LogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	buildInfo.WithLabelValues(version.Version, version.Commit, version.BuildDate).Set(1)
+
+	bestchangeApi, err := api.NewBestchangeParser(config.Bestchange)
+	if err != nil {
+		return nil, fmt.Errorf("could not create bestchange api: %s", err.Error())
+	}
+	binanceApi, err := binance.New(config.Binance)
+	if err != nil {
+		return nil, fmt.Errorf("could not create binance api: %s", err.Error())
+	}
+	bestchangeApi.UseLogger(logger)
+	binanceApi.UseLogger(logger)
+
+	store, err := storage.Open(ctx, config.App.StorageDSN, config.App.StorageBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not open storage: %w", err)
+	}
+	bestchangeApi.UseStorage(store)
+	binanceApi.UseStorage(store)
+
+	sources, err := prioritize([]markets.MarketSource{bestchangeApi, binanceApi}, config.App.MarketPriority)
 	if err != nil {
-		return nil, fmt.Errorf("could not get config: %s", err.Error())
+		return nil, fmt.Errorf("could not order the markets: %w", err)
+	}
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, source.Name())
 	}
 
-	bestchangeApi := api.NewBestchangeParser(config.Bestchange)
-	binanceApi := binance.New(config.Binance)
+	app := &App{
+		bestchange:    bestchangeApi,
+		binance:       binanceApi,
+		sources:       sources,
+		health:        newHealth(names),
+		bestAvailable: newBestAvailable(),
+		config:        config.App,
+		logger:        logger,
+		store:         store,
+	}
+	if config.Verify != nil {
+		app.verify = *config.Verify
+	}
+	if config.App.Grpc != nil {
+		app.observer = newObserverServer(app.latest)
+	}
 
-	return &App{
-		bestchange: bestchangeApi,
-		binance:    binanceApi,
-		config:     config.App,
-	}, nil
+	return app, nil
 }
 
 func (a *App) Run(ctx context.Context) error {
 	ctx, cancelFunc := context.WithCancel(ctx)
-	go startMetricsGatherer(cancelFunc)
+	go a.startMetricsGatherer(cancelFunc)
+	if a.observer != nil {
+		go a.startGrpcServer(cancelFunc)
+	}
+	defer func() {
+		if err := a.store.Close(); err != nil {
+			a.logger.Error("could not close storage", "err", err)
+		}
+	}()
 
-	log.Printf("\napp is running...\n")
-	ticker := time.NewTicker(time.Duration(a.config.FetchIntervalInHours) * time.Hour)
-	defer ticker.Stop()
+	a.logger.Info("app is running", "version", version.Version)
+	cycle := 0
+	timer := time.NewTimer(a.interval(cycle))
+	defer timer.Stop()
 
-	printMemStats()
+	a.printMemStats()
 	a.gatherData(ctx)
 outerLoop:
 	for {
 		select {
-		case <-ticker.C:
-			printMemStats()
+		case <-timer.C:
+			startTime := time.Now()
+			a.printMemStats()
 			a.gatherData(ctx)
+			cycle++
+			timer.Reset(a.nextWait(a.interval(cycle), time.Since(startTime)))
 		case <-ctx.Done():
-			printMemStats()
+			a.printMemStats()
 			break outerLoop
 		}
 	}
@@ -75,46 +182,285 @@ outerLoop:
 	return nil
 }
 
+// Reload re-reads the config and swaps the binance assets, fiats and pairs
+// and the fetch interval, the other settings keep their values until a restart
+func (a *App) Reload() error {
+	config, err := configs.Load(defaultConfigPath, os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("could not get config: %w", err)
+	}
+	if err = a.binance.Reload(config.Binance); err != nil {
+		return fmt.Errorf("could not reload binance: %w", err)
+	}
+
+	a.intervalMu.Lock()
+	a.config.FetchIntervalInHours = config.App.FetchIntervalInHours
+	a.config.RampStartIntervalInHours = config.App.RampStartIntervalInHours
+	a.config.RampUpCycles = config.App.RampUpCycles
+	interval := a.intervalAt(a.cycle)
+	a.intervalMu.Unlock()
+	a.publishInterval(interval)
+	a.logger.Info("config is reloaded, it applies from the next scrape on")
+	return nil
+}
+
+// Verify scrapes every market once and prints a per-pair pass/fail report,
+// an error is returned if any check failed
+func (a *App) Verify(ctx context.Context) error {
+	failed := 0
+	for _, report := range a.binance.Verify(ctx, a.verify) {
+		printReport("binance "+report.Pair, report.Passed, fmt.Sprintf("%d offers", report.Offers), report.Reason)
+		if !report.Passed {
+			failed++
+		}
+	}
+
+	rates, err := a.bestchange.Verify(ctx)
+	switch {
+	case err != nil:
+		printReport("bestchange", false, "", fmt.Sprintf("could not get data: %s", err.Error()))
+		failed++
+	case rates < a.verify.MinBestchangeRates:
+		printReport("bestchange", false, fmt.Sprintf("%d rates", rates), fmt.Sprintf("want at least %d", a.verify.MinBestchangeRates))
+		failed++
+	default:
+		printReport("bestchange", true, fmt.Sprintf("%d rates", rates), "")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// Validate sends a single probe request to every source that supports it,
+// the config itself is validated by Initialize already
+func (a *App) Validate(ctx context.Context) error {
+	var failed []string
+	for _, source := range a.sources {
+		prober, ok := source.(markets.Prober)
+		if !ok {
+			continue
+		}
+		if err := prober.Probe(ctx); err != nil {
+			printReport(source.Name(), false, "probe", err.Error())
+			failed = append(failed, source.Name())
+			continue
+		}
+		printReport(source.Name(), true, "probe", "")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d probes failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func printReport(name string, passed bool, details, reason string) {
+	result := "PASS"
+	if !passed {
+		result = "FAIL"
+	}
+	line := fmt.Sprintf("%s\t%s\t%s", result, name, details)
+	if reason != "" {
+		line += "\t" + reason
+	}
+	fmt.Println(line)
+}
+
+// interval returns the fetch interval after the given number of cycles,
+// interpolated from the ramp start interval during the ramp up
+func (a *App) interval(cycle int) time.Duration {
+	a.intervalMu.Lock()
+	a.cycle = cycle
+	interval := a.intervalAt(cycle)
+	a.intervalMu.Unlock()
+
+	a.publishInterval(interval)
+	a.logger.Info("next fetch is scheduled", "interval", interval)
+	return interval
+}
+
+// intervalAt returns the interval after the cycle, intervalMu must be held
+func (a *App) intervalAt(cycle int) time.Duration {
+	steady := time.Duration(a.config.FetchIntervalInHours) * time.Hour
+	interval := steady
+	if cycle < a.config.RampUpCycles && a.config.RampStartIntervalInHours > a.config.FetchIntervalInHours {
+		start := time.Duration(a.config.RampStartIntervalInHours) * time.Hour
+		interval = start - (start-steady)*time.Duration(cycle)/time.Duration(a.config.RampUpCycles)
+	}
+	return interval
+}
+
+func (a *App) publishInterval(interval time.Duration) {
+	for _, source := range a.sources {
+		scrapeInterval.WithLabelValues(source.Name()).Set(interval.Seconds())
+	}
+	a.health.setInterval(interval)
+}
+
+// nextWait returns the time until the next scrape, a scrape that took longer
+// than the interval starts the next one right away unless skipOverlapping
+// is set, then the missed ticks are skipped
+func (a *App) nextWait(interval, elapsed time.Duration) time.Duration {
+	if elapsed <= interval || !a.config.SkipOverlapping {
+		return interval - elapsed
+	}
+	a.logger.Warn("data gathering took longer than the interval, skipping ticks", "elapsed", elapsed, "skipped", int64(elapsed/interval))
+	return interval - elapsed%interval
+}
+
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-func startMetricsGatherer(cancel context.CancelFunc) {
+func (a *App) startMetricsGatherer(cancel context.CancelFunc) {
+	metrics := configs.Metrics{}
+	if a.config.Metrics != nil {
+		metrics = *a.config.Metrics
+	}
+	if metrics.Address == "" {
+		metrics.Address = defaultMetricsAddress
+	}
+	if metrics.Path == "" {
+		metrics.Path = defaultMetricsPath
+	}
+
 	r := http.NewServeMux()
-	r.Handle("/metrics", promhttp.Handler())
-	err := http.ListenAndServe(":8080", r)
+	if !metrics.Disabled {
+		gatherer := newHelpGatherer(prometheus.DefaultGatherer, a.config.MetricHelp)
+		r.Handle(metrics.Path, promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}),
+		))
+	}
+	r.HandleFunc("/healthz", healthzHandler)
+	r.HandleFunc("/readyz", a.health.readyzHandler)
+	r.HandleFunc("/api/v1/binance", a.binanceSnapshotHandler)
+
+	listener, err := listen(metrics.Address)
 	if err != nil {
-		log.Printf("could not start a metrics gatherer: %s", err.Error())
+		a.logger.Error("could not start a metrics gatherer", "address", metrics.Address, "err", err)
+		cancel()
+		return
+	}
+	a.logger.Info("serving http", "address", metrics.Address, "metricsPath", metrics.Path, "metricsDisabled", metrics.Disabled)
+	if err = http.Serve(listener, r); err != nil {
+		a.logger.Error("could not serve a metrics gatherer", "err", err)
 		cancel()
 	}
 }
 
-func (a *App) gatherData(ctx context.Context) {
-	log.Printf("data gathering started")
-	startTime := time.Now()
-	var wg sync.WaitGroup
-	wg.Add(2)
+// listen listens on a tcp host:port or on a unix:path socket,
+// a socket left behind by a previous run is removed while
+// any other file at the path is an error
+func listen(address string) (net.Listener, error) {
+	path, ok := configs.UnixSocketPath(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("could not stat %s: %w", path, err)
+	case info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	default:
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove a stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
 
-	go func() {
-		a.bestchange.GetData(ctx)
-		wg.Done()
-	}()
+// prioritize puts the named sources first in the given order, the others keep theirs
+func prioritize(sources []markets.MarketSource, priority []string) ([]markets.MarketSource, error) {
+	byName := make(map[string]markets.MarketSource, len(sources))
+	for _, source := range sources {
+		byName[source.Name()] = source
+	}
+	ordered := make([]markets.MarketSource, 0, len(sources))
+	for _, name := range priority {
+		source, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or repeated market %q", name)
+		}
+		ordered = append(ordered, source)
+		delete(byName, name)
+	}
+	for _, source := range sources {
+		if _, ok := byName[source.Name()]; ok {
+			ordered = append(ordered, source)
+		}
+	}
+	return ordered, nil
+}
 
-	go func() {
-		a.binance.GetAllData(ctx)
-		wg.Done()
-	}()
+func (a *App) gatherData(ctx context.Context) {
+	a.logger.Info("data gathering started")
+	startTime := time.Now()
+	var (
+		mu     sync.Mutex
+		failed int
+	)
+	gather := func(source markets.MarketSource) {
+		scrapeCtx, cancel := ctx, context.CancelFunc(func() {})
+		if a.config.ScrapeTimeoutInSeconds > 0 {
+			scrapeCtx, cancel = context.WithTimeout(ctx, time.Duration(a.config.ScrapeTimeoutInSeconds)*time.Second)
+		}
+		defer cancel()
+		err := source.Collect(scrapeCtx)
+		if errors.Is(scrapeCtx.Err(), context.DeadlineExceeded) {
+			scrapeTimeouts.WithLabelValues(source.Name()).Inc()
+			a.logger.Error("scrape timed out", "source", source.Name(), "timeoutInSeconds", a.config.ScrapeTimeoutInSeconds)
+		}
+		if err != nil {
+			a.logger.Error("could not gather data", "source", source.Name(), "err", err)
+			mu.Lock()
+			failed++
+			mu.Unlock()
+			return
+		}
+		a.health.success(source.Name())
+	}
 
-	wg.Wait()
-	log.Printf("all data is successfully fetched, next fetch will start in %s", startTime.Add(time.Duration(a.config.FetchIntervalInHours)*time.Hour))
+	if !a.config.SequentialMarkets {
+		var wg sync.WaitGroup
+		wg.Add(len(a.sources))
+		for _, source := range a.sources {
+			go func(source markets.MarketSource) {
+				gather(source)
+				wg.Done()
+			}(source)
+		}
+		wg.Wait()
+	} else {
+		for _, source := range a.sources {
+			if ctx.Err() != nil {
+				a.logger.Info("data gathering interrupted", "err", ctx.Err())
+				return
+			}
+			gather(source)
+		}
+	}
+	a.observeBestAvailable()
+	if a.observer != nil {
+		a.observer.publish()
+	}
+	if failed != 0 {
+		a.logger.Warn("data gathering finished with failed markets", "elapsed", time.Since(startTime), "failed", failed, "markets", len(a.sources))
+		return
+	}
+	a.logger.Info("all data is successfully fetched", "elapsed", time.Since(startTime))
 }
 
-func printMemStats() {
+func (a *App) printMemStats() {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	// For info on each, see: https://golang.org/pkg/runtime/#MemStats
-	log.Printf("Alloc = %v MiB", bToMb(m.Alloc))
-	log.Printf("\tTotalAlloc = %v MiB", bToMb(m.TotalAlloc))
-	log.Printf("\tSys = %v MiB", bToMb(m.Sys))
-	log.Printf("\tNumGC = %v\n", m.NumGC)
+	a.logger.Debug("memory stats",
+		"allocMiB", bToMb(m.Alloc),
+		"totalAllocMiB", bToMb(m.TotalAlloc),
+		"sysMiB", bToMb(m.Sys),
+		"numGC", m.NumGC)
 }
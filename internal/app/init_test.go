@@ -0,0 +1,232 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets"
+	"github.com/slvic/stock-observer/pkg/markets/binance"
+)
+
+// fakeSource is a market source counting its collects, a collect returns
+// the result of the collect func when it is set and err otherwise
+type fakeSource struct {
+	name     string
+	err      error
+	collects atomic.Int32
+	collect  func(ctx context.Context) error
+}
+
+var _ markets.MarketSource = (*fakeSource)(nil)
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Collect(ctx context.Context) error {
+	s.collects.Add(1)
+	if s.collect != nil {
+		return s.collect(ctx)
+	}
+	return s.err
+}
+
+// newTestApp returns an app scraping the sources without any market configured
+func newTestApp(config configs.App, sources ...markets.MarketSource) *App {
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, source.Name())
+	}
+	return &App{
+		sources: sources,
+		health:  newHealth(names),
+		config:  config,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestGatherData(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    configs.App
+		errs      []error
+		wantReady bool
+	}{
+		{
+			name:      "every source succeeds",
+			errs:      []error{nil, nil},
+			wantReady: true,
+		},
+		{
+			name: "a source fails",
+			errs: []error{nil, errors.New("unreachable")},
+		},
+		{
+			name:      "sequential sources",
+			config:    configs.App{SequentialMarkets: true},
+			errs:      []error{nil, nil},
+			wantReady: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := make([]markets.MarketSource, 0, len(tt.errs))
+			fakes := make([]*fakeSource, 0, len(tt.errs))
+			for i, err := range tt.errs {
+				source := &fakeSource{name: string(rune('a' + i)), err: err}
+				sources = append(sources, source)
+				fakes = append(fakes, source)
+			}
+			a := newTestApp(tt.config, sources...)
+
+			a.gatherData(context.Background())
+			for _, source := range fakes {
+				if got := source.collects.Load(); got != 1 {
+					t.Errorf("%s collected %d times, want once", source.name, got)
+				}
+			}
+			if err := a.health.ready(); (err == nil) != tt.wantReady {
+				t.Errorf("got readiness error %v, want ready %v", err, tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestGatherDataScrapeTimeout(t *testing.T) {
+	slow := &fakeSource{name: "slow", collect: func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return nil
+		}
+	}}
+	fast := &fakeSource{name: "fast"}
+	a := newTestApp(configs.App{ScrapeTimeoutInSeconds: 1}, slow, fast)
+
+	startTime := time.Now()
+	a.gatherData(context.Background())
+	if elapsed := time.Since(startTime); elapsed > 5*time.Second {
+		t.Errorf("gathering took %s, want the slow source abandoned after a second", elapsed)
+	}
+	if got := testutil.ToFloat64(scrapeTimeouts.WithLabelValues("slow")); got != 1 {
+		t.Errorf("got %v timeouts of the slow source, want 1", got)
+	}
+	if got := testutil.ToFloat64(scrapeTimeouts.WithLabelValues("fast")); got != 0 {
+		t.Errorf("got %v timeouts of the fast source, want 0", got)
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "default order", want: []string{"bestchange", "binance", "other"}},
+		{name: "prioritized", priority: []string{"binance"}, want: []string{"binance", "bestchange", "other"}},
+		{name: "every market", priority: []string{"other", "binance", "bestchange"}, want: []string{"other", "binance", "bestchange"}},
+		{name: "unknown market", priority: []string{"kraken"}, wantErr: true},
+		{name: "repeated market", priority: []string{"binance", "binance"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := []markets.MarketSource{
+				&fakeSource{name: "bestchange"}, &fakeSource{name: "binance"}, &fakeSource{name: "other"},
+			}
+			ordered, err := prioritize(sources, tt.priority)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			got := make([]string, 0, len(ordered))
+			for _, source := range ordered {
+				got = append(got, source.Name())
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatherDataSequentialOrder(t *testing.T) {
+	var (
+		order   []string
+		running atomic.Int32
+	)
+	newSource := func(name string) *fakeSource {
+		return &fakeSource{name: name, collect: func(ctx context.Context) error {
+			if running.Add(1) != 1 {
+				t.Errorf("%s collected while another source was collecting", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+			order = append(order, name)
+			running.Add(-1)
+			return nil
+		}}
+	}
+	sources, err := prioritize([]markets.MarketSource{newSource("a"), newSource("b"), newSource("c")}, []string{"c", "a"})
+	if err != nil {
+		t.Fatalf("could not order the sources: %s", err.Error())
+	}
+	a := newTestApp(configs.App{SequentialMarkets: true}, sources...)
+
+	a.gatherData(context.Background())
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got collect order %v, want %v", order, want)
+	}
+}
+
+func TestReloadInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	config := `
+app {
+  fetchIntervalInHours = 3
+}
+binance {
+  address = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search"
+  assets = ["USDT"]
+  fiats = ["RUB"]
+}
+bestchange {
+  baseurl = "https://www.bestchange.com/"
+  apiurl = "http://api.bestchange.ru/info.zip"
+}
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("could not write the config: %s", err.Error())
+	}
+	t.Setenv(configs.ConfigPathEnv, path)
+
+	binanceApi, err := binance.New(configs.Binance{Assets: []string{"USDT"}, Fiats: []string{"RUB"}})
+	if err != nil {
+		t.Fatalf("could not create binance: %s", err.Error())
+	}
+	a := newTestApp(configs.App{FetchIntervalInHours: 1}, binanceApi)
+	a.binance = binanceApi
+	a.interval(0)
+	if got := testutil.ToFloat64(scrapeInterval.WithLabelValues("binance")); got != time.Hour.Seconds() {
+		t.Fatalf("got an interval of %vs before the reload, want %vs", got, time.Hour.Seconds())
+	}
+
+	if err = a.Reload(); err != nil {
+		t.Fatalf("could not reload: %s", err.Error())
+	}
+	if got := testutil.ToFloat64(scrapeInterval.WithLabelValues("binance")); got != (3 * time.Hour).Seconds() {
+		t.Errorf("got an interval of %vs after the reload, want %vs", got, (3 * time.Hour).Seconds())
+	}
+	if got := a.interval(1); got != 3*time.Hour {
+		t.Errorf("got the next interval %s, want %s", got, 3*time.Hour)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		wantErr bool
+	}{
+		{
+			name:    "no file",
+			prepare: func(t *testing.T, path string) {},
+		},
+		{
+			name: "stale socket",
+			prepare: func(t *testing.T, path string) {
+				listener, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatalf("could not listen: %s", err.Error())
+				}
+				// keep the socket file behind like a crashed run would
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				listener.Close()
+			},
+		},
+		{
+			name: "regular file",
+			prepare: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+					t.Fatalf("could not write a file: %s", err.Error())
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.sock")
+			tt.prepare(t, path)
+
+			listener, err := listen("unix:" + path)
+			if tt.wantErr {
+				if err == nil {
+					listener.Close()
+					t.Fatalf("listening succeeded, want an error")
+				}
+				if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+					t.Errorf("the file at the socket path is gone or changed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not listen: %s", err.Error())
+			}
+			listener.Close()
+		})
+	}
+}
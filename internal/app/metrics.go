@@ -0,0 +1,30 @@
+package app
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// helpGatherer replaces the help text of the gathered metric families
+// listed in overrides, keyed by the full metric name
+type helpGatherer struct {
+	prometheus.Gatherer
+	overrides map[string]string
+}
+
+func newHelpGatherer(gatherer prometheus.Gatherer, overrides map[string]string) prometheus.Gatherer {
+	if len(overrides) == 0 {
+		return gatherer
+	}
+	return helpGatherer{Gatherer: gatherer, overrides: overrides}
+}
+
+func (g helpGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, family := range families {
+		if help, ok := g.overrides[family.GetName()]; ok {
+			family.Help = &help
+		}
+	}
+	return families, err
+}
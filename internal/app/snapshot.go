@@ -0,0 +1,32 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// binanceSnapshotHandler serves the latest observations of a pair as json,
+// GET /api/v1/binance?asset=USDT&fiat=RUB
+func (a *App) binanceSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	asset := strings.ToUpper(r.URL.Query().Get("asset"))
+	fiat := strings.ToUpper(r.URL.Query().Get("fiat"))
+	if asset == "" || fiat == "" {
+		http.Error(w, "asset and fiat are required", http.StatusBadRequest)
+		return
+	}
+	snapshot, ok := a.binance.Snapshot(asset, fiat)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s/%s has not been scraped", asset, fiat), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		a.logger.Error("could not write a snapshot", "asset", asset, "fiat", fiat, "err", err)
+	}
+}
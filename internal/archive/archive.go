@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+const rotatedTimeLayout = "20060102T150405"
+
+// Writer appends json lines to a file and rotates it by size and age,
+// a nil Writer discards everything
+type Writer struct {
+	config configs.Samples
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewWriter returns a nil Writer when cfg is nil
+func NewWriter(cfg *configs.Samples) (*Writer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	w := &Writer{config: *cfg}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends every record as a separate line
+func (w *Writer) Write(records ...interface{}) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("could not marshal a record: %w", err)
+		}
+		if w.shouldRotate() {
+			if err = w.rotate(); err != nil {
+				return fmt.Errorf("could not rotate %s: %w", w.config.Path, err)
+			}
+		}
+		n, err := w.file.Write(append(line, '\n'))
+		w.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("could not write a record: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.config.Path), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create a directory: %w", err)
+	}
+	file, err := os.OpenFile(w.config.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", w.config.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not stat %s: %w", w.config.Path, err)
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+func (w *Writer) shouldRotate() bool {
+	maxSize := w.config.MaxSizeInMegabytes * 1024 * 1024
+	maxAge := time.Duration(w.config.MaxAgeInHours) * time.Hour
+	return (maxSize != 0 && w.size >= maxSize) ||
+		(maxAge != 0 && time.Since(w.openedAt) >= maxAge)
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("could not close a file: %w", err)
+	}
+	rotated := fmt.Sprintf("%s.%s", w.config.Path, time.Now().Format(rotatedTimeLayout))
+	if err := os.Rename(w.config.Path, rotated); err != nil {
+		return fmt.Errorf("could not rename a file: %w", err)
+	}
+	if w.config.GzipRotated {
+		if err := gzipFile(rotated); err != nil {
+			slog.Error("could not gzip rotated samples", "path", rotated, "err", err)
+		}
+	}
+	return w.open()
+}
+
+func gzipFile(fileName string) error {
+	source, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("could not open a file: %w", err)
+	}
+	defer source.Close()
+
+	destination, err := os.Create(fileName + ".gz")
+	if err != nil {
+		return fmt.Errorf("could not create a file: %w", err)
+	}
+	defer destination.Close()
+
+	writer := gzip.NewWriter(destination)
+	if _, err = io.Copy(writer, source); err != nil {
+		return fmt.Errorf("could not compress a file: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("could not compress a file: %w", err)
+	}
+	return os.Remove(fileName)
+}
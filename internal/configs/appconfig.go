@@ -10,21 +10,268 @@ type AppConfig struct {
 	App        App        `hcl:"app,block"`
 	Binance    Binance    `hcl:"binance,block"`
 	Bestchange Bestchange `hcl:"bestchange,block"`
+	Verify     *Verify    `hcl:"verify,block"`
 }
 
 type App struct {
-	FetchIntervalInHours int64 `hcl:"fetchIntervalInHours"`
+	FetchIntervalInHours   int64 `hcl:"fetchIntervalInHours"`
+	ScrapeTimeoutInSeconds int64 `hcl:"scrapeTimeoutInSeconds,optional"`
+	SequentialMarkets      bool  `hcl:"sequentialMarkets,optional"`
+	// names of the markets scraped first, in order, when scraping sequentially
+	MarketPriority  []string `hcl:"marketPriority,optional"`
+	SkipOverlapping bool     `hcl:"skipOverlapping,optional"`
+	// the interval starts at RampStartIntervalInHours and goes down
+	// to FetchIntervalInHours over RampUpCycles cycles
+	RampStartIntervalInHours int64 `hcl:"rampStartIntervalInHours,optional"`
+	RampUpCycles             int   `hcl:"rampUpCycles,optional"`
+	// help text of exported metrics by full metric name, replaces the built-in one
+	MetricHelp map[string]string `hcl:"metricHelp,optional"`
+	// log level is one of debug, info, warn or error, log format is text or json
+	LogLevel  string `hcl:"logLevel,optional"`
+	LogFormat string `hcl:"logFormat,optional"`
+	// sqlite data source name, empty disables storage
+	StorageDSN string `hcl:"storageDSN,optional"`
+	// rows written per transaction, the binance offers are written every batch
+	StorageBatchSize int `hcl:"storageBatchSize,optional"`
+
+	Metrics *Metrics `hcl:"metrics,block"`
+	Grpc    *Grpc    `hcl:"grpc,block"`
+}
+
+// Grpc serves the latest data over grpc when set,
+// Address is host:port or unix:/path/to/socket
+type Grpc struct {
+	Address string `hcl:"address"`
+}
+
+// Metrics sets where the http server listens, Address is host:port
+// or unix:/path/to/socket, Disabled drops the Path endpoint only
+type Metrics struct {
+	Address  string `hcl:"address,optional"`
+	Path     string `hcl:"path,optional"`
+	Disabled bool   `hcl:"disabled,optional"`
+}
+
+// Verify holds the thresholds checked by the verify subcommand, a zero threshold is not checked
+type Verify struct {
+	MinOffers          int     `hcl:"minOffers,optional"`
+	MinPrice           float64 `hcl:"minPrice,optional"`
+	MaxPrice           float64 `hcl:"maxPrice,optional"`
+	MinBestchangeRates int     `hcl:"minBestchangeRates,optional"`
 }
 
 type Binance struct {
-	Address string   `hcl:"address"`
-	Assets  []string `hcl:"assets"`
-	Fiats   []string `hcl:"fiats"`
+	Address           string   `hcl:"address,optional"`
+	FallbackAddresses []string `hcl:"fallbackAddresses,optional"`
+	Addresses         []string `hcl:"addresses,optional"`
+	// credentials of the endpoints with sign set
+	ApiKey    string `hcl:"apiKey,optional"`
+	ApiSecret string `hcl:"apiSecret,optional"`
+	// signed requests are accepted for this long after their timestamp, 0 keeps the binance default
+	RecvWindowInSeconds int64 `hcl:"recvWindowInSeconds,optional"`
+	// the offset to the server time answered here is measured at startup
+	// and added to the timestamp of signed requests, empty does not sync
+	ServerTimeAddress       string            `hcl:"serverTimeAddress,optional"`
+	Proxy                   string            `hcl:"proxy,optional"`
+	Assets                  []string          `hcl:"assets"`
+	Fiats                   []string          `hcl:"fiats"`
+	RequestIdHeader         string            `hcl:"requestIdHeader,optional"`
+	UserAgent               string            `hcl:"userAgent,optional"`
+	Headers                 map[string]string `hcl:"headers,optional"`
+	RetryOnEmpty            int               `hcl:"retryOnEmpty,optional"`
+	RetryErrorCodes         []string          `hcl:"retryErrorCodes,optional"`
+	ErrorCodeRetries        int               `hcl:"errorCodeRetries,optional"`
+	MaxRetries              int               `hcl:"maxRetries,optional"`
+	BaseDelayInMilliseconds int64             `hcl:"baseDelayInMilliseconds,optional"`
+	MaxDelayInMilliseconds  int64             `hcl:"maxDelayInMilliseconds,optional"`
+	Rows                    int32             `hcl:"rows,optional"`
+	MaxPages                int               `hcl:"maxPages,optional"`
+	MaxConcurrency          int               `hcl:"maxConcurrency,optional"`
+	PageConcurrency         int               `hcl:"pageConcurrency,optional"`
+	RequestsPerSecond       float64           `hcl:"requestsPerSecond,optional"`
+	Burst                   int               `hcl:"burst,optional"`
+	MaxFailedPercent        float64           `hcl:"maxFailedPercent,optional"`
+	GzipRequests            bool              `hcl:"gzipRequests,optional"`
+	MerchantOnly            *bool             `hcl:"merchantOnly,optional"`
+	MerchantBoth            bool              `hcl:"merchantBoth,optional"`
+	BestN                   int               `hcl:"bestN,optional"`
+	MinOffersToPublish      int               `hcl:"minOffersToPublish,optional"`
+	TrimFraction            float64           `hcl:"trimFraction,optional"`
+	DecayRanks              []int             `hcl:"decayRanks,optional"`
+	Percentiles             []float64         `hcl:"percentiles,optional"`
+	LiquidityBands          []float64         `hcl:"liquidityBands,optional"`
+	CorrelationWindow       int               `hcl:"correlationWindow,optional"`
+	ZScoreWindow            int               `hcl:"zScoreWindow,optional"`
+	ZScoreThreshold         float64           `hcl:"zScoreThreshold,optional"`
+	PayMethods              []string          `hcl:"payMethods,optional"`
+	PayTypes                []string          `hcl:"payTypes,optional"`
+	SplitByPayType          bool              `hcl:"splitByPayType,optional"`
+	CompletePairsOnly       bool              `hcl:"completePairsOnly,optional"`
+	StaleOnFailure          bool              `hcl:"staleOnFailure,optional"`
+	DetectTwoSided          bool              `hcl:"detectTwoSided,optional"`
+	ExcludeTwoSided         bool              `hcl:"excludeTwoSided,optional"`
+	MidPrice                bool              `hcl:"midPrice,optional"`
+	Spread                  bool              `hcl:"spread,optional"`
+	// the spread is only exported while both sides were scraped this close, 0 always exports it
+	SpreadToleranceInMilliseconds int64 `hcl:"spreadToleranceInMilliseconds,optional"`
+
+	CurrencyGroups       map[string]string `hcl:"currencyGroups,optional"`
+	DefaultCurrencyGroup string            `hcl:"defaultCurrencyGroup,optional"`
+
+	AdaptiveTimeout *AdaptiveTimeout `hcl:"adaptiveTimeout,block"`
+	PairCircuit     *PairCircuit     `hcl:"pairCircuit,block"`
+	Samples         *Samples         `hcl:"samples,block"`
+	Discovery       *Discovery       `hcl:"discovery,block"`
+	Histograms      *Histograms      `hcl:"histograms,block"`
+	AdaptiveRows    *AdaptiveRows    `hcl:"adaptiveRows,block"`
+	Clients         []HttpClient     `hcl:"client,block"`
+	Pairs           []Pair           `hcl:"pair,block"`
+	PriceBands      []PriceBand      `hcl:"priceBand,block"`
+	Relabels        []Relabel        `hcl:"relabel,block"`
+	Endpoints       []Endpoint       `hcl:"endpoint,block"`
+}
+
+// Endpoint is an address requests are tried at, requests to an endpoint
+// with Sign set are signed with the api key and secret; endpoints replace
+// address, fallbackAddresses and addresses when set
+type Endpoint struct {
+	Address string `hcl:"address"`
+	Sign    bool   `hcl:"sign,optional"`
+}
+
+// PairCircuit skips a pair for CooldownInSeconds after FailureThreshold consecutive failures
+type PairCircuit struct {
+	FailureThreshold  int   `hcl:"failureThreshold"`
+	CooldownInSeconds int64 `hcl:"cooldownInSeconds"`
+}
+
+// Discovery adds the assets binance lists as tradable for a fiat to the
+// configured ones every IntervalInHours, Regex filters the discovered assets
+// and MaxAssets caps the assets scraped per fiat
+type Discovery struct {
+	Address         string `hcl:"address,optional"`
+	IntervalInHours int64  `hcl:"intervalInHours,optional"`
+	Regex           string `hcl:"regex,optional"`
+	MaxAssets       int    `hcl:"maxAssets,optional"`
+}
+
+// Histograms switches the price, tradableQuantity and commissionRate
+// summaries to histograms, empty buckets fall back to the defaults;
+// a NativeBucketFactor above 1 also exports them as native histograms
+// with buckets growing by up to that factor, at most NativeMaxBuckets of them
+type Histograms struct {
+	PriceBuckets            []float64 `hcl:"priceBuckets,optional"`
+	TradableQuantityBuckets []float64 `hcl:"tradableQuantityBuckets,optional"`
+	CommissionRateBuckets   []float64 `hcl:"commissionRateBuckets,optional"`
+	NativeBucketFactor      float64   `hcl:"nativeBucketFactor,optional"`
+	NativeMaxBuckets        int       `hcl:"nativeMaxBuckets,optional"`
+}
+
+// AdaptiveRows lowers rows while a cycle takes longer than BudgetInSeconds
+// and raises them while it takes less than half of it, within [MinRows, MaxRows],
+// MaxRows defaults to the largest page binance answers
+type AdaptiveRows struct {
+	MinRows         int32 `hcl:"minRows"`
+	MaxRows         int32 `hcl:"maxRows,optional"`
+	BudgetInSeconds int64 `hcl:"budgetInSeconds"`
+}
+
+// Samples appends every parsed offer to a json lines file rotated by size and age
+type Samples struct {
+	Path               string `hcl:"path"`
+	MaxSizeInMegabytes int64  `hcl:"maxSizeInMegabytes,optional"`
+	MaxAgeInHours      int64  `hcl:"maxAgeInHours,optional"`
+	GzipRotated        bool   `hcl:"gzipRotated,optional"`
+}
+
+// PriceBand drops ads priced outside of [MinPrice, MaxPrice], a zero bound is not checked
+type PriceBand struct {
+	Asset    string  `hcl:"asset"`
+	Fiat     string  `hcl:"fiat"`
+	MinPrice float64 `hcl:"minPrice,optional"`
+	MaxPrice float64 `hcl:"maxPrice,optional"`
+}
+
+// Pair overrides settings of a single asset/fiat pair,
+// pairs with a higher Priority are scheduled first,
+// Client is the name of the http client the pair is requested with
+type Pair struct {
+	Asset    string `hcl:"asset"`
+	Fiat     string `hcl:"fiat"`
+	Rows     int32  `hcl:"rows,optional"`
+	Priority int    `hcl:"priority,optional"`
+	Client   string `hcl:"client,optional"`
+}
+
+// HttpClient is a named http client that pairs can be routed through,
+// a zero timeout follows the adaptive timeout
+type HttpClient struct {
+	Name             string            `hcl:"name"`
+	TimeoutInSeconds int64             `hcl:"timeoutInSeconds,optional"`
+	Proxy            string            `hcl:"proxy,optional"`
+	Headers          map[string]string `hcl:"headers,optional"`
+}
+
+// AdaptiveTimeout sets the request timeout to a multiple of the recent median
+// request latency, bounded by min and max
+type AdaptiveTimeout struct {
+	Multiplier   float64 `hcl:"multiplier"`
+	MinInSeconds int64   `hcl:"minInSeconds"`
+	MaxInSeconds int64   `hcl:"maxInSeconds"`
 }
 
 type Bestchange struct {
-	BaseUrl string `hcl:"baseurl"`
-	ApiUrl  string `hcl:"apiurl"`
+	BaseUrl    string   `hcl:"baseurl"`
+	ApiUrl     string   `hcl:"apiurl"`
+	ApiUrls    []string `hcl:"apiUrls,optional"`
+	Proxy      string   `hcl:"proxy,optional"`
+	ZipFile    string   `hcl:"zipFile,optional"`
+	ExtractDir string   `hcl:"extractDir,optional"`
+	// extracted files older than this are downloaded again even when unchanged
+	MaxExtractAgeInHours int64             `hcl:"maxExtractAgeInHours,optional"`
+	CurrencyIDs          []int             `hcl:"currencyIds,optional"`
+	Merges               []CurrencyMerge   `hcl:"merge,block"`
+	Labels               map[string]string `hcl:"labels,optional"`
+	// iuliia scheme names are transliterated with, "none" keeps them as they are
+	Transliteration string `hcl:"transliteration,optional"`
+
+	AdaptiveTimeout *AdaptiveTimeout `hcl:"adaptiveTimeout,block"`
+	RateBounds      *RateBounds      `hcl:"rateBounds,block"`
+	Relabels        []Relabel        `hcl:"relabel,block"`
+
+	BestExchangerPairs []BestchangePair `hcl:"bestExchanger,block"`
+	// only rates of the listed pairs are exported, empty means all
+	Pairs []BestchangePair `hcl:"pair,block"`
+}
+
+// BestchangePair is a pair of currency names as listed in bm_cy.dat,
+// names of merged currencies are their canonical name
+type BestchangePair struct {
+	Source string `hcl:"source"`
+	Target string `hcl:"target"`
+}
+
+// RateBounds drops exchange rates outside of the bounds, a zero bound is not checked
+type RateBounds struct {
+	MinGiveRate float64 `hcl:"minGiveRate,optional"`
+	MaxGiveRate float64 `hcl:"maxGiveRate,optional"`
+	MinGetRate  float64 `hcl:"minGetRate,optional"`
+	MaxGetRate  float64 `hcl:"maxGetRate,optional"`
+}
+
+// Relabel keeps, drops or rewrites label sets before they are exported,
+// Action is one of keep, drop or replace
+type Relabel struct {
+	Action      string `hcl:"action"`
+	SourceLabel string `hcl:"sourceLabel"`
+	Regex       string `hcl:"regex,optional"`
+	TargetLabel string `hcl:"targetLabel,optional"`
+	Replacement string `hcl:"replacement,optional"`
+}
+
+type CurrencyMerge struct {
+	Name        string `hcl:"name"`
+	CurrencyIDs []int  `hcl:"currencyIds"`
 }
 
 func GetConfig(fileName string) (AppConfig, error) {
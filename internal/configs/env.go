@@ -0,0 +1,171 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigPathEnv overrides the path of the config file
+const ConfigPathEnv = "STOCK_OBSERVER_CONFIG"
+
+// fileSuffix marks a variable holding the path of a file with the value,
+// like docker and kubernetes secrets
+const fileSuffix = "_FILE"
+
+// envOverride sets a field of the config from an environment variable
+type envOverride struct {
+	name  string
+	apply func(config *AppConfig, value string) error
+}
+
+// envOverrides take precedence over the config file
+var envOverrides = []envOverride{
+	{"SCRAPE_INTERVAL", func(config *AppConfig, value string) error {
+		hours, err := parseHours(value)
+		if err != nil {
+			return err
+		}
+		config.App.FetchIntervalInHours = hours
+		return nil
+	}},
+	{"LOG_LEVEL", func(config *AppConfig, value string) error {
+		config.App.LogLevel = value
+		return nil
+	}},
+	{"LOG_FORMAT", func(config *AppConfig, value string) error {
+		config.App.LogFormat = value
+		return nil
+	}},
+	{"STORAGE_DSN", func(config *AppConfig, value string) error {
+		config.App.StorageDSN = value
+		return nil
+	}},
+	{"METRICS_ADDRESS", func(config *AppConfig, value string) error {
+		if config.App.Metrics == nil {
+			config.App.Metrics = &Metrics{}
+		}
+		config.App.Metrics.Address = value
+		return nil
+	}},
+	{"BINANCE_ADDRESS", func(config *AppConfig, value string) error {
+		config.Binance.Address = value
+		return nil
+	}},
+	{"BINANCE_ADDRESSES", func(config *AppConfig, value string) error {
+		config.Binance.Addresses = splitList(value)
+		return nil
+	}},
+	{"BINANCE_ASSETS", func(config *AppConfig, value string) error {
+		config.Binance.Assets = splitList(value)
+		return nil
+	}},
+	{"BINANCE_FIATS", func(config *AppConfig, value string) error {
+		config.Binance.Fiats = splitList(value)
+		return nil
+	}},
+	{"BINANCE_PROXY", func(config *AppConfig, value string) error {
+		config.Binance.Proxy = value
+		return nil
+	}},
+	{"BINANCE_API_KEY", func(config *AppConfig, value string) error {
+		config.Binance.ApiKey = value
+		return nil
+	}},
+	{"BINANCE_API_SECRET", func(config *AppConfig, value string) error {
+		config.Binance.ApiSecret = value
+		return nil
+	}},
+	{"BESTCHANGE_API_URL", func(config *AppConfig, value string) error {
+		config.Bestchange.ApiUrl = value
+		return nil
+	}},
+	{"BESTCHANGE_PROXY", func(config *AppConfig, value string) error {
+		config.Bestchange.Proxy = value
+		return nil
+	}},
+}
+
+// Load reads the config file, overlays the set environment variables
+// and validates the result, every invalid variable and field is listed
+// in a single ValidationError; every variable may be given as NAME_FILE
+// instead, the path of a file whose content without trailing newlines is the value
+func Load(fileName string, lookupEnv func(string) (string, bool)) (AppConfig, error) {
+	if path, ok := lookupEnv(ConfigPathEnv); ok && path != "" {
+		fileName = path
+	}
+	config, err := GetConfig(fileName)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	var problems []string
+	for _, override := range envOverrides {
+		value, ok, err := lookupOverride(override.name, lookupEnv)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err = override.apply(&config, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", override.name, err.Error()))
+		}
+	}
+
+	var validationError *ValidationError
+	if err = config.Validate(); errors.As(err, &validationError) {
+		problems = append(problems, validationError.Problems...)
+	}
+	if len(problems) != 0 {
+		return AppConfig{}, &ValidationError{Problems: problems}
+	}
+	return config, nil
+}
+
+// lookupOverride returns the value of the variable or of the file NAME_FILE points to
+func lookupOverride(name string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	value, ok := lookupEnv(name)
+	path, fromFile := lookupEnv(name + fileSuffix)
+	if !fromFile {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("both %s and %s%s are set", name, name, fileSuffix)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s: could not read the file: %s", name, fileSuffix, err.Error())
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// parseHours accepts whole hours either as a number or as a duration like 2h
+func parseHours(value string) (int64, error) {
+	if hours, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return hours, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither hours nor a duration", value)
+	}
+	if duration%time.Hour != 0 {
+		return 0, fmt.Errorf("%q is not a whole number of hours", value)
+	}
+	return int64(duration / time.Hour), nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,201 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const minimalConfig = `
+app {
+  fetchIntervalInHours = 1
+}
+binance {
+  address = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search"
+  assets = ["USDT"]
+  fiats = ["RUB"]
+}
+bestchange {
+  baseurl = "https://www.bestchange.com/"
+  apiurl = "http://api.bestchange.ru/info.zip"
+}
+`
+
+// writeFile writes the content into a file of a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write %s: %s", name, err.Error())
+	}
+	return path
+}
+
+// mapEnv looks the variables up in env
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	secret := writeFile(t, "dsn", "file:secret.db\n")
+	missing := filepath.Join(t.TempDir(), "missing")
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantDSN      string
+		wantProblems []string
+	}{
+		{
+			name:    "value from a file",
+			env:     map[string]string{"STORAGE_DSN_FILE": secret},
+			wantDSN: "file:secret.db",
+		},
+		{
+			name:    "plain variable",
+			env:     map[string]string{"STORAGE_DSN": "file:plain.db"},
+			wantDSN: "file:plain.db",
+		},
+		{
+			name:         "both are set",
+			env:          map[string]string{"STORAGE_DSN": "file:plain.db", "STORAGE_DSN_FILE": secret},
+			wantProblems: []string{"both STORAGE_DSN and STORAGE_DSN_FILE are set"},
+		},
+		{
+			name: "unreadable file",
+			env:  map[string]string{"STORAGE_DSN_FILE": missing},
+			wantProblems: []string{
+				"STORAGE_DSN_FILE: could not read the file: open " + missing + ": no such file or directory",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Load(writeFile(t, "config.hcl", minimalConfig), mapEnv(tt.env))
+			if len(tt.wantProblems) == 0 {
+				if err != nil {
+					t.Fatalf("could not load: %s", err.Error())
+				}
+				if config.App.StorageDSN != tt.wantDSN {
+					t.Errorf("got storage dsn %q, want %q", config.App.StorageDSN, tt.wantDSN)
+				}
+				return
+			}
+			var validationError *ValidationError
+			if !errors.As(err, &validationError) {
+				t.Fatalf("got error %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationError.Problems, tt.wantProblems) {
+				t.Errorf("got problems %q, want %q", validationError.Problems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	other := writeFile(t, "other.hcl", strings.Replace(minimalConfig, "fetchIntervalInHours = 1", "fetchIntervalInHours = 5", 1))
+	tests := []struct {
+		name   string
+		env    map[string]string
+		assert func(t *testing.T, config AppConfig)
+	}{
+		{
+			name: "the file without variables",
+			assert: func(t *testing.T, config AppConfig) {
+				if config.App.FetchIntervalInHours != 1 || !reflect.DeepEqual(config.Binance.Assets, []string{"USDT"}) {
+					t.Errorf("got interval %d and assets %v, want those of the file", config.App.FetchIntervalInHours, config.Binance.Assets)
+				}
+			},
+		},
+		{
+			name: "variables take precedence over the file",
+			env: map[string]string{
+				"SCRAPE_INTERVAL": "3",
+				"BINANCE_ADDRESS": "https://mirror.example.com/search",
+				"BINANCE_ASSETS":  "BTC, ETH",
+				"LOG_LEVEL":       "debug",
+			},
+			assert: func(t *testing.T, config AppConfig) {
+				if config.App.FetchIntervalInHours != 3 {
+					t.Errorf("got interval %d, want 3", config.App.FetchIntervalInHours)
+				}
+				if config.Binance.Address != "https://mirror.example.com/search" {
+					t.Errorf("got address %q, want the variable", config.Binance.Address)
+				}
+				if !reflect.DeepEqual(config.Binance.Assets, []string{"BTC", "ETH"}) {
+					t.Errorf("got assets %v, want [BTC ETH]", config.Binance.Assets)
+				}
+				if !reflect.DeepEqual(config.Binance.Fiats, []string{"RUB"}) || config.App.LogLevel != "debug" {
+					t.Errorf("got fiats %v and log level %q, want the fiats of the file and debug", config.Binance.Fiats, config.App.LogLevel)
+				}
+			},
+		},
+		{
+			name: "interval as a duration",
+			env:  map[string]string{"SCRAPE_INTERVAL": "2h"},
+			assert: func(t *testing.T, config AppConfig) {
+				if config.App.FetchIntervalInHours != 2 {
+					t.Errorf("got interval %d, want 2", config.App.FetchIntervalInHours)
+				}
+			},
+		},
+		{
+			name: "another config file",
+			env:  map[string]string{ConfigPathEnv: other},
+			assert: func(t *testing.T, config AppConfig) {
+				if config.App.FetchIntervalInHours != 5 {
+					t.Errorf("got interval %d, want the 5 of the other file", config.App.FetchIntervalInHours)
+				}
+			},
+		},
+		{
+			name: "variables take precedence over another config file",
+			env:  map[string]string{ConfigPathEnv: other, "SCRAPE_INTERVAL": "4"},
+			assert: func(t *testing.T, config AppConfig) {
+				if config.App.FetchIntervalInHours != 4 {
+					t.Errorf("got interval %d, want 4", config.App.FetchIntervalInHours)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Load(writeFile(t, "config.hcl", minimalConfig), mapEnv(tt.env))
+			if err != nil {
+				t.Fatalf("could not load: %s", err.Error())
+			}
+			tt.assert(t, config)
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	env := map[string]string{
+		"SCRAPE_INTERVAL": "often",
+		"BINANCE_ADDRESS": "not a url",
+		"BINANCE_FIATS":   "",
+		"METRICS_ADDRESS": "localhost",
+	}
+	_, err := Load(writeFile(t, "config.hcl", minimalConfig), mapEnv(env))
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("got error %v, want a ValidationError", err)
+	}
+	for _, field := range []string{"SCRAPE_INTERVAL", "binance.address", "binance.fiats", "app.metrics.address"} {
+		found := false
+		for _, problem := range validationError.Problems {
+			found = found || strings.Contains(problem, field)
+		}
+		if !found {
+			t.Errorf("got problems %q, want one about %s", validationError.Problems, field)
+		}
+	}
+	if len(validationError.Problems) != 4 {
+		t.Errorf("got %d problems %q, want 4", len(validationError.Problems), validationError.Problems)
+	}
+}
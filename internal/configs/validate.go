@@ -0,0 +1,225 @@
+package configs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxBinanceRows is the largest page binance answers, a page asking
+// for more rows comes back short and ends the pages of a side
+const MaxBinanceRows = 20
+
+// maxRecvWindowInSeconds is the largest recvWindow binance accepts
+const maxRecvWindowInSeconds = 60
+
+// unixPrefix marks a listen address that is a unix socket path
+const unixPrefix = "unix:"
+
+// ValidateListenAddress checks the address is host:port or unix:path, empty is the default one
+func ValidateListenAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	if path, ok := UnixSocketPath(address); ok {
+		if path == "" {
+			return fmt.Errorf("unix socket path is empty")
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("could not parse %q: %w", address, err)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 0 || number > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// UnixSocketPath returns the socket path of a unix:path address
+func UnixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(address, unixPrefix), true
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that the required fields are present and the addresses are urls
+func (c AppConfig) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	checkUrl := func(field, value string) {
+		if value == "" {
+			addProblem("%s is required", field)
+			return
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			addProblem("%s %q is not an http url", field, value)
+		}
+	}
+
+	checkAdaptiveTimeout := func(field string, timeout *AdaptiveTimeout) {
+		if timeout == nil {
+			return
+		}
+		if timeout.Multiplier <= 0 {
+			addProblem("%s.multiplier must be positive", field)
+		}
+		if timeout.MinInSeconds <= 0 {
+			addProblem("%s.minInSeconds must be positive", field)
+		}
+		if timeout.MaxInSeconds < timeout.MinInSeconds {
+			addProblem("%s.maxInSeconds must not be less than minInSeconds", field)
+		}
+	}
+
+	if c.App.FetchIntervalInHours <= 0 {
+		addProblem("app.fetchIntervalInHours must be positive")
+	}
+	if c.App.StorageBatchSize < 0 {
+		addProblem("app.storageBatchSize must not be negative")
+	}
+	if metrics := c.App.Metrics; metrics != nil {
+		if err := ValidateListenAddress(metrics.Address); err != nil {
+			addProblem("app.metrics.address: %s", err.Error())
+		}
+		if metrics.Path != "" && !strings.HasPrefix(metrics.Path, "/") {
+			addProblem("app.metrics.path %q must start with /", metrics.Path)
+		}
+	}
+	if grpc := c.App.Grpc; grpc != nil {
+		if grpc.Address == "" {
+			addProblem("app.grpc.address must not be empty")
+		} else if err := ValidateListenAddress(grpc.Address); err != nil {
+			addProblem("app.grpc.address: %s", err.Error())
+		}
+	}
+
+	if len(c.Binance.Addresses) == 0 && len(c.Binance.Endpoints) == 0 {
+		checkUrl("binance.address", c.Binance.Address)
+		for _, address := range c.Binance.FallbackAddresses {
+			checkUrl("binance.fallbackAddresses", address)
+		}
+	}
+	for _, address := range c.Binance.Addresses {
+		checkUrl("binance.addresses", address)
+	}
+	for _, endpoint := range c.Binance.Endpoints {
+		checkUrl("binance.endpoint.address", endpoint.Address)
+		if endpoint.Sign && (c.Binance.ApiKey == "" || c.Binance.ApiSecret == "") {
+			addProblem("binance.endpoint %q is signed but binance.apiKey or binance.apiSecret is empty", endpoint.Address)
+		}
+	}
+	if c.Binance.RecvWindowInSeconds < 0 || c.Binance.RecvWindowInSeconds > maxRecvWindowInSeconds {
+		addProblem("binance.recvWindowInSeconds %d is not within [0, %d]", c.Binance.RecvWindowInSeconds, maxRecvWindowInSeconds)
+	}
+	if c.Binance.ServerTimeAddress != "" {
+		checkUrl("binance.serverTimeAddress", c.Binance.ServerTimeAddress)
+	}
+	if len(c.Binance.Assets) == 0 {
+		addProblem("binance.assets is empty")
+	}
+	if len(c.Binance.Fiats) == 0 {
+		addProblem("binance.fiats is empty")
+	}
+	if c.Binance.PageConcurrency < 0 {
+		addProblem("binance.pageConcurrency must not be negative")
+	}
+	if c.Binance.BestN < 0 {
+		addProblem("binance.bestN must not be negative")
+	}
+	if c.Binance.TrimFraction < 0 || c.Binance.TrimFraction >= 0.5 {
+		addProblem("binance.trimFraction %v is not within [0, 0.5)", c.Binance.TrimFraction)
+	}
+	if c.Binance.ZScoreWindow < 0 {
+		addProblem("binance.zScoreWindow must not be negative")
+	}
+	if c.Binance.ZScoreThreshold < 0 {
+		addProblem("binance.zScoreThreshold must not be negative")
+	}
+	if c.Binance.CorrelationWindow < 0 {
+		addProblem("binance.correlationWindow must not be negative")
+	}
+	checkAdaptiveTimeout("binance.adaptiveTimeout", c.Binance.AdaptiveTimeout)
+	if rows := c.Binance.AdaptiveRows; rows != nil {
+		if rows.MinRows < 1 {
+			addProblem("binance.adaptiveRows.minRows must be positive")
+		}
+		if rows.MaxRows < 0 || (rows.MaxRows != 0 && rows.MaxRows < rows.MinRows) {
+			addProblem("binance.adaptiveRows.maxRows must not be less than minRows")
+		}
+		if rows.BudgetInSeconds <= 0 {
+			addProblem("binance.adaptiveRows.budgetInSeconds must be positive")
+		}
+	}
+	if histograms := c.Binance.Histograms; histograms != nil {
+		if histograms.NativeBucketFactor != 0 && histograms.NativeBucketFactor <= 1 {
+			addProblem("binance.histograms.nativeBucketFactor %v must be above 1", histograms.NativeBucketFactor)
+		}
+		if histograms.NativeMaxBuckets < 0 {
+			addProblem("binance.histograms.nativeMaxBuckets must not be negative")
+		}
+	}
+	if rows := c.Binance.Rows; rows < 0 || rows > MaxBinanceRows {
+		addProblem("binance.rows %d is not within [1, %d]", rows, MaxBinanceRows)
+	}
+	for _, pair := range c.Binance.Pairs {
+		if pair.Rows < 0 || pair.Rows > MaxBinanceRows {
+			addProblem("binance.pair %s/%s rows %d is not within [1, %d]", pair.Asset, pair.Fiat, pair.Rows, MaxBinanceRows)
+		}
+	}
+	if c.Binance.MaxConcurrency < 0 {
+		addProblem("binance.maxConcurrency must not be negative")
+	}
+	if c.Binance.MaxRetries < 0 {
+		addProblem("binance.maxRetries must not be negative")
+	}
+	if c.Binance.BaseDelayInMilliseconds < 0 || c.Binance.MaxDelayInMilliseconds < 0 {
+		addProblem("binance.baseDelayInMilliseconds and binance.maxDelayInMilliseconds must not be negative")
+	} else if c.Binance.MaxDelayInMilliseconds != 0 && c.Binance.BaseDelayInMilliseconds > c.Binance.MaxDelayInMilliseconds {
+		addProblem("binance.baseDelayInMilliseconds must not be greater than maxDelayInMilliseconds")
+	}
+	if circuit := c.Binance.PairCircuit; circuit != nil {
+		if circuit.FailureThreshold < 1 {
+			addProblem("binance.pairCircuit.failureThreshold must be at least 1")
+		}
+		if circuit.CooldownInSeconds < 0 {
+			addProblem("binance.pairCircuit.cooldownInSeconds must not be negative")
+		}
+	}
+	if c.Binance.MaxFailedPercent < 0 || c.Binance.MaxFailedPercent > 100 {
+		addProblem("binance.maxFailedPercent %v is not within [0, 100]", c.Binance.MaxFailedPercent)
+	}
+
+	checkUrl("bestchange.baseurl", c.Bestchange.BaseUrl)
+	checkAdaptiveTimeout("bestchange.adaptiveTimeout", c.Bestchange.AdaptiveTimeout)
+	if c.Bestchange.MaxExtractAgeInHours < 0 {
+		addProblem("bestchange.maxExtractAgeInHours must not be negative")
+	}
+	if len(c.Bestchange.ApiUrls) == 0 {
+		checkUrl("bestchange.apiurl", c.Bestchange.ApiUrl)
+	}
+	for _, apiUrl := range c.Bestchange.ApiUrls {
+		checkUrl("bestchange.apiUrls", apiUrl)
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package configs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// validConfig is the smallest config passing validation
+func validConfig() AppConfig {
+	return AppConfig{
+		App: App{FetchIntervalInHours: 1},
+		Binance: Binance{
+			Address: "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search",
+			Assets:  []string{"USDT"},
+			Fiats:   []string{"RUB"},
+		},
+		Bestchange: Bestchange{
+			BaseUrl: "https://www.bestchange.com/",
+			ApiUrl:  "http://api.bestchange.ru/info.zip",
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(c *AppConfig)
+		wantProblems []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *AppConfig) {},
+		},
+		{
+			name:         "negative pageConcurrency",
+			modify:       func(c *AppConfig) { c.Binance.PageConcurrency = -1 },
+			wantProblems: []string{"binance.pageConcurrency must not be negative"},
+		},
+		{
+			name:         "grpc without a port",
+			modify:       func(c *AppConfig) { c.App.Grpc = &Grpc{Address: "localhost"} },
+			wantProblems: []string{`app.grpc.address: could not parse "localhost": address localhost: missing port in address`},
+		},
+		{
+			name:         "negative bestN",
+			modify:       func(c *AppConfig) { c.Binance.BestN = -1 },
+			wantProblems: []string{"binance.bestN must not be negative"},
+		},
+		{
+			name:         "trimFraction of a half",
+			modify:       func(c *AppConfig) { c.Binance.TrimFraction = 0.5 },
+			wantProblems: []string{"binance.trimFraction 0.5 is not within [0, 0.5)"},
+		},
+		{
+			name:         "negative trimFraction",
+			modify:       func(c *AppConfig) { c.Binance.TrimFraction = -0.1 },
+			wantProblems: []string{"binance.trimFraction -0.1 is not within [0, 0.5)"},
+		},
+		{
+			name: "negative z-score settings",
+			modify: func(c *AppConfig) {
+				c.Binance.ZScoreWindow = -1
+				c.Binance.ZScoreThreshold = -3
+			},
+			wantProblems: []string{
+				"binance.zScoreWindow must not be negative",
+				"binance.zScoreThreshold must not be negative",
+			},
+		},
+		{
+			name:         "negative correlationWindow",
+			modify:       func(c *AppConfig) { c.Binance.CorrelationWindow = -1 },
+			wantProblems: []string{"binance.correlationWindow must not be negative"},
+		},
+		{
+			name:   "adaptive rows without maxRows",
+			modify: func(c *AppConfig) { c.Binance.AdaptiveRows = &AdaptiveRows{MinRows: 5, BudgetInSeconds: 60} },
+		},
+		{
+			name: "adaptive rows without minRows",
+			modify: func(c *AppConfig) {
+				c.Binance.AdaptiveRows = &AdaptiveRows{MaxRows: 20, BudgetInSeconds: 60}
+			},
+			wantProblems: []string{"binance.adaptiveRows.minRows must be positive"},
+		},
+		{
+			name: "adaptive rows with maxRows below minRows",
+			modify: func(c *AppConfig) {
+				c.Binance.AdaptiveRows = &AdaptiveRows{MinRows: 10, MaxRows: 5, BudgetInSeconds: 60}
+			},
+			wantProblems: []string{"binance.adaptiveRows.maxRows must not be less than minRows"},
+		},
+		{
+			name:         "negative storageBatchSize",
+			modify:       func(c *AppConfig) { c.App.StorageBatchSize = -1 },
+			wantProblems: []string{"app.storageBatchSize must not be negative"},
+		},
+		{
+			name:         "negative maxExtractAgeInHours",
+			modify:       func(c *AppConfig) { c.Bestchange.MaxExtractAgeInHours = -1 },
+			wantProblems: []string{"bestchange.maxExtractAgeInHours must not be negative"},
+		},
+		{
+			name: "signed endpoint without credentials",
+			modify: func(c *AppConfig) {
+				c.Binance.Endpoints = []Endpoint{{Address: "https://p2p.binance.com/search", Sign: true}}
+			},
+			wantProblems: []string{`binance.endpoint "https://p2p.binance.com/search" is signed but binance.apiKey or binance.apiSecret is empty`},
+		},
+		{
+			name:         "recvWindow above a minute",
+			modify:       func(c *AppConfig) { c.Binance.RecvWindowInSeconds = 61 },
+			wantProblems: []string{"binance.recvWindowInSeconds 61 is not within [0, 60]"},
+		},
+		{
+			name:         "serverTimeAddress without a host",
+			modify:       func(c *AppConfig) { c.Binance.ServerTimeAddress = "api/v3/time" },
+			wantProblems: []string{`binance.serverTimeAddress "api/v3/time" is not an http url`},
+		},
+		{
+			name:         "native bucket factor of 1",
+			modify:       func(c *AppConfig) { c.Binance.Histograms = &Histograms{NativeBucketFactor: 1} },
+			wantProblems: []string{"binance.histograms.nativeBucketFactor 1 must be above 1"},
+		},
+		{
+			name:         "negative native max buckets",
+			modify:       func(c *AppConfig) { c.Binance.Histograms = &Histograms{NativeBucketFactor: 1.1, NativeMaxBuckets: -1} },
+			wantProblems: []string{"binance.histograms.nativeMaxBuckets must not be negative"},
+		},
+		{
+			name:         "rows above a page",
+			modify:       func(c *AppConfig) { c.Binance.Rows = 50 },
+			wantProblems: []string{"binance.rows 50 is not within [1, 20]"},
+		},
+		{
+			name: "pair rows above a page",
+			modify: func(c *AppConfig) {
+				c.Binance.Pairs = []Pair{{Asset: "USDT", Fiat: "RUB", Rows: 50}, {Asset: "BTC", Fiat: "RUB", Rows: 20}}
+			},
+			wantProblems: []string{"binance.pair USDT/RUB rows 50 is not within [1, 20]"},
+		},
+		{
+			name: "valid adaptive timeouts",
+			modify: func(c *AppConfig) {
+				c.Binance.AdaptiveTimeout = &AdaptiveTimeout{Multiplier: 3, MinInSeconds: 5, MaxInSeconds: 5}
+				c.Bestchange.AdaptiveTimeout = &AdaptiveTimeout{Multiplier: 0.5, MinInSeconds: 1, MaxInSeconds: 60}
+			},
+		},
+		{
+			name:   "zero adaptive timeout",
+			modify: func(c *AppConfig) { c.Binance.AdaptiveTimeout = &AdaptiveTimeout{} },
+			wantProblems: []string{
+				"binance.adaptiveTimeout.multiplier must be positive",
+				"binance.adaptiveTimeout.minInSeconds must be positive",
+			},
+		},
+		{
+			name: "adaptive timeout min above max",
+			modify: func(c *AppConfig) {
+				c.Bestchange.AdaptiveTimeout = &AdaptiveTimeout{Multiplier: 3, MinInSeconds: 30, MaxInSeconds: 10}
+			},
+			wantProblems: []string{"bestchange.adaptiveTimeout.maxInSeconds must not be less than minInSeconds"},
+		},
+		{
+			name:         "negative maxConcurrency",
+			modify:       func(c *AppConfig) { c.Binance.MaxConcurrency = -1 },
+			wantProblems: []string{"binance.maxConcurrency must not be negative"},
+		},
+		{
+			name:         "negative maxRetries",
+			modify:       func(c *AppConfig) { c.Binance.MaxRetries = -1 },
+			wantProblems: []string{"binance.maxRetries must not be negative"},
+		},
+		{
+			name:         "negative retry delay",
+			modify:       func(c *AppConfig) { c.Binance.BaseDelayInMilliseconds = -500 },
+			wantProblems: []string{"binance.baseDelayInMilliseconds and binance.maxDelayInMilliseconds must not be negative"},
+		},
+		{
+			name: "base retry delay above the max",
+			modify: func(c *AppConfig) {
+				c.Binance.BaseDelayInMilliseconds = 2000
+				c.Binance.MaxDelayInMilliseconds = 1000
+			},
+			wantProblems: []string{"binance.baseDelayInMilliseconds must not be greater than maxDelayInMilliseconds"},
+		},
+		{
+			name:   "pair circuit that never opens",
+			modify: func(c *AppConfig) { c.Binance.PairCircuit = &PairCircuit{FailureThreshold: 0, CooldownInSeconds: -1} },
+			wantProblems: []string{
+				"binance.pairCircuit.failureThreshold must be at least 1",
+				"binance.pairCircuit.cooldownInSeconds must not be negative",
+			},
+		},
+		{
+			name:         "adaptive rows without a budget",
+			modify:       func(c *AppConfig) { c.Binance.AdaptiveRows = &AdaptiveRows{MinRows: 10} },
+			wantProblems: []string{"binance.adaptiveRows.budgetInSeconds must be positive"},
+		},
+		{
+			name:         "maxFailedPercent above 100",
+			modify:       func(c *AppConfig) { c.Binance.MaxFailedPercent = 150 },
+			wantProblems: []string{"binance.maxFailedPercent 150 is not within [0, 100]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.modify(&config)
+
+			err := config.Validate()
+			if len(tt.wantProblems) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+			var validationError *ValidationError
+			if !errors.As(err, &validationError) {
+				t.Fatalf("got error %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationError.Problems, tt.wantProblems) {
+				t.Errorf("got problems %q, want %q", validationError.Problems, tt.wantProblems)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+// window is the number of recent latencies the median is taken from
+const window = 100
+
+func init() {
+	prometheus.MustRegister(requestTimeout)
+}
+
+var requestTimeout = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "request_timeout_seconds",
+		Help: "Current request timeout of a market, in seconds.",
+	},
+	[]string{"market"},
+)
+
+// Tracker keeps recent request latencies of a market and derives
+// the request timeout for the next cycle from their median
+type Tracker struct {
+	market string
+	config *configs.AdaptiveTimeout
+	fixed  time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// NewTracker returns a tracker that always reports fixed when cfg is nil
+func NewTracker(market string, cfg *configs.AdaptiveTimeout, fixed time.Duration) *Tracker {
+	return &Tracker{
+		market:  market,
+		config:  cfg,
+		fixed:   fixed,
+		samples: make([]time.Duration, 0, window),
+	}
+}
+
+func (t *Tracker) Observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < window {
+		t.samples = append(t.samples, latency)
+		return
+	}
+	t.samples[t.next] = latency
+	t.next = (t.next + 1) % window
+}
+
+// Timeout computes the timeout for the next cycle and exposes it as a gauge
+func (t *Tracker) Timeout() time.Duration {
+	timeout := t.timeout()
+	requestTimeout.WithLabelValues(t.market).Set(timeout.Seconds())
+	return timeout
+}
+
+func (t *Tracker) timeout() time.Duration {
+	if t.config == nil {
+		return t.fixed
+	}
+	minimum := time.Duration(t.config.MinInSeconds) * time.Second
+	maximum := time.Duration(t.config.MaxInSeconds) * time.Second
+
+	t.mu.Lock()
+	sorted := append([]time.Duration(nil), t.samples...)
+	t.mu.Unlock()
+	if len(sorted) == 0 {
+		return maximum
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	timeout := time.Duration(t.config.Multiplier * float64(sorted[len(sorted)/2]))
+	if timeout < minimum {
+		return minimum
+	}
+	if timeout > maximum {
+		return maximum
+	}
+	return timeout
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	textFormat = "text"
+	jsonFormat = "json"
+)
+
+// New builds a logger of the level (debug, info, warn or error, info when empty)
+// writing in the format (text or json, text when empty)
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if level != "" {
+		if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	switch strings.ToLower(format) {
+	case "", textFormat:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case jsonFormat:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantDebug bool
+		wantJson  bool
+		wantErr   bool
+	}{
+		{name: "defaults"},
+		{name: "debug text", level: "debug", format: "text", wantDebug: true},
+		{name: "json", level: "warn", format: "JSON", wantJson: true},
+		{name: "unknown level", level: "loud", wantErr: true},
+		{name: "unknown format", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger, err := New(&output, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			logger.Debug("debug line")
+			logger.Error("could not get data", "source", "binance", "asset", "USDT", "fiat", "RUB", "err", "unreachable")
+
+			if got := strings.Contains(output.String(), "debug line"); got != tt.wantDebug {
+				t.Errorf("got debug logged %v, want %v", got, tt.wantDebug)
+			}
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			errorLine := lines[len(lines)-1]
+			if !tt.wantJson {
+				for _, attr := range []string{"level=ERROR", "source=binance", "asset=USDT", "fiat=RUB", "err=unreachable"} {
+					if !strings.Contains(errorLine, attr) {
+						t.Errorf("got %q, want it to carry %s", errorLine, attr)
+					}
+				}
+				return
+			}
+			var record map[string]string
+			if err = json.Unmarshal([]byte(errorLine), &record); err != nil {
+				t.Fatalf("could not decode %q: %s", errorLine, err.Error())
+			}
+			want := map[string]string{"level": "ERROR", "source": "binance", "asset": "USDT", "fiat": "RUB", "err": "unreachable"}
+			for key, value := range want {
+				if record[key] != value {
+					t.Errorf("got %s %q, want %q", key, record[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Transport returns a transport sending requests through the proxy,
+// http, https, socks5 and socks5h proxy urls are supported;
+// without a proxy the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply
+func Transport(proxy string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy == "" {
+		transport.Proxy = http.ProxyFromEnvironment
+		return transport, nil
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse proxy url: %w", err)
+	}
+	switch proxyUrl.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyUrl.Scheme)
+	}
+	if proxyUrl.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", proxy)
+	}
+	transport.Proxy = http.ProxyURL(proxyUrl)
+	return transport, nil
+}
@@ -0,0 +1,112 @@
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+const (
+	keepAction    = "keep"
+	dropAction    = "drop"
+	replaceAction = "replace"
+
+	defaultRegex       = "(.*)"
+	defaultReplacement = "$1"
+)
+
+type rule struct {
+	action      string
+	source      int
+	target      int
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// Rules rewrite or drop label sets of a market following prometheus
+// relabel_config semantics, they are immutable and safe for concurrent use
+type Rules struct {
+	names []string
+	rules []rule
+}
+
+// New validates the relabel configs against the label names of a market
+func New(names []string, cfgs []configs.Relabel) (Rules, error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+
+	rules := make([]rule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		var r rule
+
+		switch cfg.Action {
+		case keepAction, dropAction, replaceAction:
+			r.action = cfg.Action
+		default:
+			return Rules{}, fmt.Errorf("relabel rule %d: unknown action %q", i, cfg.Action)
+		}
+
+		source, ok := index[cfg.SourceLabel]
+		if !ok {
+			return Rules{}, fmt.Errorf("relabel rule %d: unknown source label %q", i, cfg.SourceLabel)
+		}
+		r.source = source
+
+		expression := cfg.Regex
+		if expression == "" {
+			expression = defaultRegex
+		}
+		regex, err := regexp.Compile("^(?:" + expression + ")$")
+		if err != nil {
+			return Rules{}, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		r.regex = regex
+
+		if r.action == replaceAction {
+			target, ok := index[cfg.TargetLabel]
+			if !ok {
+				return Rules{}, fmt.Errorf("relabel rule %d: unknown target label %q", i, cfg.TargetLabel)
+			}
+			r.target = target
+			r.replacement = cfg.Replacement
+			if r.replacement == "" {
+				r.replacement = defaultReplacement
+			}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return Rules{names: names, rules: rules}, nil
+}
+
+// Apply returns the relabeled values and false when the label set is dropped
+func (r Rules) Apply(values []string) ([]string, bool) {
+	if len(r.rules) == 0 {
+		return values, true
+	}
+	relabeled := append([]string(nil), values...)
+	for _, rule := range r.rules {
+		value := relabeled[rule.source]
+		switch rule.action {
+		case keepAction:
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case dropAction:
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case replaceAction:
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			relabeled[rule.target] = string(rule.regex.ExpandString(nil, rule.replacement, value, match))
+		}
+	}
+	return relabeled, true
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	bcmodels "github.com/slvic/stock-observer/pkg/bestchange/models"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+const (
+	driverName = "sqlite3"
+	// rows inserted per transaction unless configured otherwise
+	defaultBatchSize = 1000
+)
+
+// migrations create the tables, every statement has to be idempotent
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS binance_ads (
+		scraped_at INTEGER NOT NULL,
+		trade_type TEXT NOT NULL,
+		asset TEXT NOT NULL,
+		fiat TEXT NOT NULL,
+		price REAL NOT NULL,
+		tradable_quantity REAL NOT NULL,
+		commission_rate REAL NOT NULL,
+		advertiser_no TEXT NOT NULL,
+		min_trans_amount REAL,
+		max_trans_amount REAL
+	)`,
+	`CREATE INDEX IF NOT EXISTS binance_ads_pair ON binance_ads (asset, fiat, scraped_at)`,
+	`CREATE TABLE IF NOT EXISTS bestchange_rates (
+		scraped_at INTEGER NOT NULL,
+		source_currency TEXT NOT NULL,
+		target_currency TEXT NOT NULL,
+		exchanger_id INTEGER NOT NULL,
+		exchanger_name TEXT NOT NULL,
+		give_rate REAL NOT NULL,
+		get_rate REAL NOT NULL,
+		target_currency_reserve REAL NOT NULL,
+		good_reviews_count INTEGER NOT NULL,
+		bad_reviews_count INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS bestchange_rates_pair ON bestchange_rates (source_currency, target_currency, scraped_at)`,
+}
+
+// Store persists scraped ads and rates into sqlite, batchSize rows per
+// transaction; a nil Store discards everything
+type Store struct {
+	db        *sql.DB
+	batchSize int
+}
+
+// Open returns a nil Store when dsn is empty and migrates the database otherwise,
+// a zero batchSize is the default one
+func Open(ctx context.Context, dsn string, batchSize int) (*Store, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open a database: %w", err)
+	}
+	// sqlite allows a single writer at a time
+	db.SetMaxOpenConns(1)
+	for _, migration := range migrations {
+		if _, err = db.ExecContext(ctx, migration); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("could not migrate a database: %w", err)
+		}
+	}
+	return &Store{db: db, batchSize: batchSize}, nil
+}
+
+// BatchSize is the number of rows written per transaction, writers may
+// collect this many rows before writing them
+func (s *Store) BatchSize() int {
+	if s == nil {
+		return 0
+	}
+	return s.batchSize
+}
+
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// WriteOffers inserts the offers of a scrape, a transaction per batch
+func (s *Store) WriteOffers(ctx context.Context, samples []models.OfferSample) error {
+	if s == nil || len(samples) == 0 {
+		return nil
+	}
+	return s.insert(ctx, `INSERT INTO binance_ads (
+		scraped_at, trade_type, asset, fiat, price, tradable_quantity,
+		commission_rate, advertiser_no, min_trans_amount, max_trans_amount
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, len(samples), func(i int) []interface{} {
+		sample := samples[i]
+		return []interface{}{
+			sample.Time.Unix(), sample.TradeType, sample.Asset, sample.Fiat, sample.Price, sample.TradableQuantity,
+			sample.CommissionRate, sample.AdvertiserNo, sample.MinTransAmount, sample.MaxTransAmount,
+		}
+	})
+}
+
+// WriteRates inserts the rates of a scrape, a transaction per batch
+func (s *Store) WriteRates(ctx context.Context, scrapedAt time.Time, rates []bcmodels.ExchangeRate) error {
+	if s == nil || len(rates) == 0 {
+		return nil
+	}
+	return s.insert(ctx, `INSERT INTO bestchange_rates (
+		scraped_at, source_currency, target_currency, exchanger_id, exchanger_name,
+		give_rate, get_rate, target_currency_reserve, good_reviews_count, bad_reviews_count
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, len(rates), func(i int) []interface{} {
+		rate := rates[i]
+		return []interface{}{
+			scrapedAt.Unix(), rate.SourceCurrency, rate.TargetCurrency, rate.ExchangerId, rate.ExchangerName,
+			rate.GiveRate, rate.GetRate, rate.TargetCurrencyReserve, rate.GoodReviewsCount, rate.BadReviewsCount,
+		}
+	})
+}
+
+// insert runs the statement for n rows, committing every batchSize rows
+func (s *Store) insert(ctx context.Context, query string, n int, row func(i int) []interface{}) error {
+	for start := 0; start < n; start += s.batchSize {
+		end := start + s.batchSize
+		if end > n {
+			end = n
+		}
+		if err := s.insertBatch(ctx, query, start, end, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertBatch runs the statement for the rows [start, end) within a single transaction
+func (s *Store) insertBatch(ctx context.Context, query string, start, end int, row func(i int) []interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin a transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	statement, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("could not prepare a statement: %w", err)
+	}
+	defer statement.Close()
+
+	for i := start; i < end; i++ {
+		if _, err = statement.ExecContext(ctx, row(i)...); err != nil {
+			return fmt.Errorf("could not insert a row: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit a transaction: %w", err)
+	}
+	return nil
+}
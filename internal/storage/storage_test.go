@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bcmodels "github.com/slvic/stock-observer/pkg/bestchange/models"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func openTestStore(t *testing.T, batchSize int) *Store {
+	t.Helper()
+	store, err := Open(context.Background(), filepath.Join(t.TempDir(), "observer.db"), batchSize)
+	if err != nil {
+		t.Fatalf("could not open storage: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func countRows(t *testing.T, store *Store, table string) int {
+	t.Helper()
+	var rows int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&rows); err != nil {
+		t.Fatalf("could not count the rows of %s: %s", table, err.Error())
+	}
+	return rows
+}
+
+func TestOpenWithoutDSN(t *testing.T) {
+	store, err := Open(context.Background(), "", 10)
+	if err != nil || store != nil {
+		t.Fatalf("got %v, %v, want a nil store", store, err)
+	}
+	if err = store.WriteOffers(context.Background(), []models.OfferSample{{}}); err != nil {
+		t.Errorf("a nil store could not discard the offers: %s", err.Error())
+	}
+	if got := store.BatchSize(); got != 0 {
+		t.Errorf("got a batch size of %d of a nil store, want 0", got)
+	}
+}
+
+func TestWriteBatches(t *testing.T) {
+	tests := []struct {
+		name          string
+		batchSize     int
+		rows          int
+		wantBatchSize int
+	}{
+		{name: "default batch size", rows: 3, wantBatchSize: defaultBatchSize},
+		{name: "fewer rows than a batch", batchSize: 10, rows: 3, wantBatchSize: 10},
+		{name: "several batches", batchSize: 2, rows: 5, wantBatchSize: 2},
+		{name: "whole batches", batchSize: 2, rows: 4, wantBatchSize: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openTestStore(t, tt.batchSize)
+			if got := store.BatchSize(); got != tt.wantBatchSize {
+				t.Errorf("got a batch size of %d, want %d", got, tt.wantBatchSize)
+			}
+
+			samples := make([]models.OfferSample, tt.rows)
+			rates := make([]bcmodels.ExchangeRate, tt.rows)
+			for i := range samples {
+				samples[i] = models.OfferSample{Time: time.Now(), Offer: models.Offer{TradeType: "BUY", Asset: "USDT", Fiat: "RUB", Price: float64(90 + i)}}
+				rates[i] = bcmodels.ExchangeRate{SourceCurrency: "Tether", TargetCurrency: "Ruble", ExchangerId: i, GiveRate: 1, GetRate: 90}
+			}
+			if err := store.WriteOffers(context.Background(), samples); err != nil {
+				t.Fatalf("could not write the offers: %s", err.Error())
+			}
+			if err := store.WriteRates(context.Background(), time.Now(), rates); err != nil {
+				t.Fatalf("could not write the rates: %s", err.Error())
+			}
+			if got := countRows(t, store, "binance_ads"); got != tt.rows {
+				t.Errorf("got %d stored offers, want %d", got, tt.rows)
+			}
+			if got := countRows(t, store, "bestchange_rates"); got != tt.rows {
+				t.Errorf("got %d stored rates, want %d", got, tt.rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package summary
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const successResult = "success"
+
+func init() {
+	prometheus.MustRegister(cycleRequests)
+	prometheus.MustRegister(scrapeDuration)
+	prometheus.MustRegister(scrapeLastSuccess)
+}
+
+var cycleRequests = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "last_cycle_requests",
+		Help: "Requests of the last scrape cycle by result.",
+	},
+	[]string{"market", "result"},
+)
+
+var (
+	scrapeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scrape_duration_seconds",
+			Help:    "Duration of a scrape of a source and of its phases, in seconds.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		},
+		[]string{"source", "phase"},
+	)
+	scrapeLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scrape_last_success_timestamp",
+			Help: "Unix time of the last successful scrape of a source, in seconds.",
+		},
+		[]string{"source"},
+	)
+)
+
+// TotalPhase is the phase of the whole scrape
+const TotalPhase = "total"
+
+// ObservePhase records how long a phase of a scrape of the source took
+func ObservePhase(source, phase string, startTime time.Time) {
+	scrapeDuration.WithLabelValues(source, phase).Observe(time.Since(startTime).Seconds())
+}
+
+// MarkSuccess records that a scrape of the source succeeded now
+func MarkSuccess(source string) {
+	scrapeLastSuccess.WithLabelValues(source).SetToCurrentTime()
+}
+
+// Cycle accumulates request outcomes of a single scrape cycle of a market
+type Cycle struct {
+	market string
+
+	mu          sync.Mutex
+	succeeded   int
+	failed      map[string]int
+	failedPairs []string
+}
+
+// NewCycle starts a cycle, every kind of failure the market can report
+// has to be listed so the counts of the previous cycle are reset
+func NewCycle(market string, kinds ...string) *Cycle {
+	failed := make(map[string]int, len(kinds))
+	for _, kind := range kinds {
+		failed[kind] = 0
+	}
+	return &Cycle{
+		market: market,
+		failed: failed,
+	}
+}
+
+func (c *Cycle) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.succeeded++
+}
+
+// Failure records a failed request of the given kind, pair may be empty
+func (c *Cycle) Failure(kind, pair string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed[kind]++
+	if pair != "" {
+		c.failedPairs = append(c.failedPairs, pair)
+	}
+}
+
+// Failed returns the number of failed requests
+func (c *Cycle) Failed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var failed int
+	for _, count := range c.failed {
+		failed += count
+	}
+	return failed
+}
+
+// Err returns an error when more than maxFailedPercent of the requests of the cycle failed
+func (c *Cycle) Err(maxFailedPercent float64) error {
+	failed := c.Failed()
+	c.mu.Lock()
+	total := failed + c.succeeded
+	c.mu.Unlock()
+	if total == 0 || float64(failed)*100 <= maxFailedPercent*float64(total) {
+		return nil
+	}
+	return fmt.Errorf("%d of %d %s requests failed", failed, total, c.market)
+}
+
+// Report logs a single summary line and exposes the counts of the cycle
+func (c *Cycle) Report() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cycleRequests.WithLabelValues(c.market, successResult).Set(float64(c.succeeded))
+
+	kinds := make([]string, 0, len(c.failed))
+	for kind, count := range c.failed {
+		cycleRequests.WithLabelValues(c.market, kind).Set(float64(count))
+		if count != 0 {
+			kinds = append(kinds, fmt.Sprintf("%s=%d", kind, count))
+		}
+	}
+	sort.Strings(kinds)
+	sort.Strings(c.failedPairs)
+
+	slog.Info("cycle summary",
+		"source", c.market,
+		"succeeded", c.succeeded,
+		"failed", strings.Join(kinds, " "),
+		"failedPairs", strings.Join(c.failedPairs, ", "))
+}
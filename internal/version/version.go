@@ -0,0 +1,9 @@
+package version
+
+// set at build time with
+// -ldflags "-X github.com/slvic/stock-observer/internal/version.Version=..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
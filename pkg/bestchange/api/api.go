@@ -2,15 +2,22 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"strings"
+	"os"
+	"sync"
 	"time"
 
-	"github.com/mehanizm/iuliia-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/latency"
+	"github.com/slvic/stock-observer/internal/proxy"
+	"github.com/slvic/stock-observer/internal/relabel"
+	"github.com/slvic/stock-observer/internal/storage"
+	"github.com/slvic/stock-observer/internal/summary"
 	"github.com/slvic/stock-observer/pkg/bestchange/models"
 	"golang.org/x/sync/errgroup"
 )
@@ -18,16 +25,20 @@ import (
 func init() {
 	prometheus.MustRegister(bestchageGiveRate)
 	prometheus.MustRegister(bestchageGetRate)
+	prometheus.MustRegister(bestchangeDataAge)
+	prometheus.MustRegister(bestchangeInvalidRate)
 }
 
 var (
 	bceGiveRateSummaryOpts = prometheus.SummaryOpts{
 		Namespace: "bestchange",
 		Name:      "exchangeGiveRate",
+		Help:      "Amount of the source currency given per exchange.",
 	}
 	bceGetRateSummaryOpts = prometheus.SummaryOpts{
 		Namespace: "bestchange",
 		Name:      "exchangeGetRate",
+		Help:      "Amount of the target currency received per exchange.",
 	}
 
 	bcLabels = []string{"exchanger", "source", "target"}
@@ -42,43 +53,295 @@ var (
 		bceGetRateSummaryOpts,
 		bcLabels,
 	)
+	bestchangeDataAge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "bestchange",
+			Name:      "data_age_seconds",
+			Help:      "Age of the bestchange api data, in seconds.",
+		},
+	)
+	bestchangeInvalidRate = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "bestchange",
+			Name:      "invalid_rate_total",
+			Help:      "Exchange rates dropped as invalid or out of bounds.",
+		},
+	)
+)
+
+const (
+	defaultTimeout = 15 * time.Second
+	// extracted files are downloaded again at least this often
+	defaultMaxExtractAge = 6 * time.Hour
+)
+
+// phases of a scrape, download includes unzipping
+const (
+	downloadPhase = "download"
+	parsePhase    = "parse"
+)
+
+const (
+	downloadErrorKind = "download"
+	unzipErrorKind    = "unzip"
+	parseErrorKind    = "parse"
 )
 
 type Bestchange struct {
-	config     configs.Bestchange
-	httpClient http.Client
+	config      configs.Bestchange
+	httpClient  http.Client
+	labelMapper LabelMapper
+	latency     *latency.Tracker
+	relabel     relabel.Rules
+	best        *bestExchangers
+	downloads   *downloads
+	latest      *latestRates
+	paths       paths
+	// extracted files older than this are not reused
+	maxExtractAge time.Duration
+	logger        *slog.Logger
+	store         *storage.Store
 }
 
-func NewBestchangeParser(cfg configs.Bestchange) *Bestchange {
-	return &Bestchange{
-		config:     cfg,
-		httpClient: http.Client{Timeout: 15 * time.Second},
+func NewBestchangeParser(cfg configs.Bestchange) (*Bestchange, error) {
+	relabelRules, err := relabel.New(bcLabels, cfg.Relabels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relabel rules: %w", err)
+	}
+	labelMapper, err := newLabelMapper(cfg.Labels, cfg.Transliteration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label mapping: %w", err)
 	}
+	transport, err := proxy.Transport(cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	maxExtractAge := time.Duration(cfg.MaxExtractAgeInHours) * time.Hour
+	if maxExtractAge == 0 {
+		maxExtractAge = defaultMaxExtractAge
+	}
+	return &Bestchange{
+		config:        cfg,
+		httpClient:    http.Client{Timeout: defaultTimeout, Transport: transport},
+		labelMapper:   labelMapper,
+		latency:       latency.NewTracker("bestchange", cfg.AdaptiveTimeout, defaultTimeout),
+		relabel:       relabelRules,
+		best:          newBestExchangers(cfg.BestExchangerPairs),
+		downloads:     newDownloads(),
+		latest:        newLatestRates(),
+		paths:         newPaths(cfg),
+		maxExtractAge: maxExtractAge,
+		logger:        slog.Default().With("source", "bestchange"),
+	}, nil
+}
+
+// UseLogger replaces the default logger, the source attribute is added to it
+func (b *Bestchange) UseLogger(logger *slog.Logger) {
+	b.logger = logger.With("source", b.Name())
 }
 
-func (b Bestchange) GetData(ctx context.Context) {
-	log.Printf("bestchange api data gathering started")
+// UseStorage persists the valid rates of every scrape into the store
+func (b *Bestchange) UseStorage(store *storage.Store) {
+	b.store = store
+}
+
+// UseLabelMapper replaces the default transliteration of label values
+func (b *Bestchange) UseLabelMapper(mapper LabelMapper) {
+	b.labelMapper = mapper
+}
 
-	err := b.getBcApiFile()
+func (b Bestchange) Name() string {
+	return "bestchange"
+}
+
+func (b Bestchange) Collect(ctx context.Context) error {
+	return b.GetData(ctx)
+}
+
+func (b Bestchange) GetData(ctx context.Context) error {
+	b.logger.Info("data gathering started")
+	b.httpClient.Timeout = b.latency.Timeout()
+
+	cycle := summary.NewCycle("bestchange", downloadErrorKind, unzipErrorKind, parseErrorKind)
+	defer cycle.Report()
+	defer summary.ObservePhase("bestchange", summary.TotalPhase, time.Now())
+
+	scrapedAt := time.Now()
+	best := b.newBestRates()
+	codes := make(codeRates)
+	var (
+		stored []models.ExchangeRate
+		rates  int
+	)
+	// every rate is observed as it is parsed, the rates of a scrape are never held at once
+	err := b.fetchExchangeRates(ctx, func(exchangeRate models.ExchangeRate, exchangerLabel string) {
+		rates++
+		if !b.validRate(exchangeRate) {
+			bestchangeInvalidRate.Inc()
+			return
+		}
+		best.add(exchangeRate, exchangerLabel)
+		codes.add(exchangeRate, exchangerLabel, scrapedAt)
+		if b.store != nil {
+			stored = append(stored, exchangeRate)
+			if len(stored) >= b.store.BatchSize() {
+				b.storeRates(ctx, scrapedAt, stored)
+				stored = stored[:0]
+			}
+		}
+		labels, keep := b.relabel.Apply([]string{
+			exchangerLabel,
+			b.labelMapper.Map(exchangeRate.SourceCurrency),
+			b.labelMapper.Map(exchangeRate.TargetCurrency),
+		})
+		if !keep {
+			return
+		}
+		{ //give rate
+			bestchageGiveRate.WithLabelValues(labels...).Observe(exchangeRate.GiveRate)
+		}
+		{ //get rate
+			bestchageGetRate.WithLabelValues(labels...).Observe(exchangeRate.GetRate)
+		}
+	})
 	if err != nil {
-		log.Printf("could not get bestchange api file: %s", err.Error())
-		return
+		cycle.Failure(err.kind, "")
+		return fmt.Errorf("could not get bestchange data: %w", err)
 	}
+	b.observeBestExchangers(best)
+	b.latest.replace(codes)
+	b.storeRates(ctx, scrapedAt, stored)
+	cycle.Success()
+	summary.MarkSuccess("bestchange")
+	b.logger.Info("data is gathered", "rates", rates)
+	return nil
+}
 
-	err = unzipSource(bcApiZipFileName, bcApiFolder)
-	if err != nil {
-		log.Printf("could not unzip bestchange api file: %s", err.Error())
-		return
+// storeRates writes a batch of the rates of a scrape
+func (b Bestchange) storeRates(ctx context.Context, scrapedAt time.Time, rates []models.ExchangeRate) {
+	if err := b.store.WriteRates(ctx, scrapedAt, rates); err != nil {
+		b.logger.Error("could not store rates", "rates", len(rates), "err", err)
+	}
+}
+
+// Verify fetches the api data once and returns the number of valid exchange rates
+func (b Bestchange) Verify(ctx context.Context) (int, error) {
+	var valid int
+	if err := b.fetchExchangeRates(ctx, func(exchangeRate models.ExchangeRate, _ string) {
+		if b.validRate(exchangeRate) {
+			valid++
+		}
+	}); err != nil {
+		return 0, err
+	}
+	return valid, nil
+}
+
+// apiUrls are the urls of the api parts, apiurl alone when apiUrls is empty
+func (b Bestchange) apiUrls() []string {
+	if len(b.config.ApiUrls) == 0 {
+		return []string{b.config.ApiUrl}
+	}
+	return b.config.ApiUrls
+}
+
+// Probe checks every api url answers a HEAD request without downloading it
+func (b Bestchange) Probe(ctx context.Context) error {
+	for _, url := range b.apiUrls() {
+		request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return fmt.Errorf("could not create a request to %s: %w", url, err)
+		}
+		response, err := b.httpClient.Do(request)
+		if err != nil {
+			return fmt.Errorf("could not probe %s: %w", url, err)
+		}
+		response.Body.Close()
+		if response.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s responded with %s", url, response.Status)
+		}
+	}
+	return nil
+}
+
+// fetchError tells at which step fetching bestchange data failed
+type fetchError struct {
+	kind string
+	err  error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// getApiParts downloads and extracts every configured api zip in parallel,
+// each into its own directory; the returned time is the last modification
+// of the oldest part
+func (b Bestchange) getApiParts(ctx context.Context) (time.Time, *fetchError) {
+	var (
+		mu       sync.Mutex
+		dataTime time.Time
+	)
+	downloader, ctx := errgroup.WithContext(ctx)
+	for i, url := range b.apiUrls() {
+		url, fileName, extractDir := url, b.paths.partZipFile(i), b.paths.partExtractDir(i)
+		downloader.Go(func() error {
+			partTime, changed, err := b.getBcApiFile(ctx, url, fileName)
+			if err != nil {
+				return &fetchError{kind: downloadErrorKind, err: fmt.Errorf("could not get bestchange api file %s: %w", url, err)}
+			}
+			if changed {
+				err = extract(fileName, extractDir)
+				if err != nil {
+					return &fetchError{kind: unzipErrorKind, err: fmt.Errorf("could not unzip bestchange api file %s: %w", url, err)}
+				}
+				b.downloads.extractedFrom(url)
+			} else {
+				b.logger.Info("api file is not modified, reusing extracted files", "url", url)
+			}
+			mu.Lock()
+			if dataTime.IsZero() || partTime.Before(dataTime) {
+				dataTime = partTime
+			}
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := downloader.Wait(); err != nil {
+		var fetchErr *fetchError
+		if errors.As(err, &fetchErr) {
+			return time.Time{}, fetchErr
+		}
+		return time.Time{}, &fetchError{kind: downloadErrorKind, err: err}
 	}
+	return dataTime, nil
+}
+
+// fetchExchangeRates downloads, unzips and parses the api data, every converted
+// rate is handed to handle along with the label of its exchanger as it is parsed
+func (b Bestchange) fetchExchangeRates(ctx context.Context, handle func(models.ExchangeRate, string)) *fetchError {
+	downloadTime := time.Now()
+	dataTime, fetchErr := b.getApiParts(ctx)
+	if fetchErr != nil {
+		return fetchErr
+	}
+	summary.ObservePhase("bestchange", downloadPhase, downloadTime)
+	bestchangeDataAge.Set(time.Since(dataTime).Seconds())
+
+	parseTime := time.Now()
+	defer summary.ObservePhase("bestchange", parsePhase, parseTime)
 
 	rawGetter, _ := errgroup.WithContext(ctx)
 
 	rawCurrencies := make(chan map[int]string, 1)
 	rawExchangers := make(chan map[int]string, 1)
-	rawExchangeRates := make(chan []models.RawExchangeRate, 1)
 
 	rawGetter.Go(func() error {
-		currencies, err := getRawCurrencies(currenciesFile)
+		currencies, err := b.mergeParts(currenciesFile, getRawCurrencies)
 		if err != nil {
 			return fmt.Errorf("could not get raw currencies: %w", err)
 		}
@@ -86,45 +349,92 @@ func (b Bestchange) GetData(ctx context.Context) {
 		return nil
 	})
 	rawGetter.Go(func() error {
-		exchangers, err := getRawExchangers(exchangerOfficesFile)
+		exchangers, err := b.mergeParts(exchangerOfficesFile, getRawExchangers)
 		if err != nil {
 			return fmt.Errorf("could not get raw exchangers: %w", err)
 		}
 		rawExchangers <- exchangers
 		return nil
 	})
-	rawGetter.Go(func() error {
-		exchangeRates, err := getRawExchangeRates(exchangeRatesFile)
-		if err != nil {
-			return fmt.Errorf("could not get raw exchange rates: %w", err)
-		}
-		rawExchangeRates <- exchangeRates
-		return nil
-	})
 
-	if err = rawGetter.Wait(); err != nil {
-		log.Printf("could not get raw bestchange data: %s", err.Error())
-		return
+	if err := rawGetter.Wait(); err != nil {
+		return &fetchError{kind: parseErrorKind, err: fmt.Errorf("could not get raw bestchange data: %w", err)}
 	}
 
-	exchangeRates := getExchangeRates(<-rawExchangeRates, <-rawExchangers, <-rawCurrencies)
+	exchangers := <-rawExchangers
+	exchangerLabels := b.exchangerLabels(exchangers)
+	convert := b.rateConverter(exchangers, <-rawCurrencies)
+	// every rates file is checked before any rate is handed on, so a
+	// malformed line does not leave the rates before it published
+	var fileNames []string
+	for part := range b.apiUrls() {
+		fileName := b.paths.apiFile(part, exchangeRatesFile)
+		if _, err := os.Stat(fileName); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := checkRawExchangeRates(ctx, fileName); err != nil {
+			return &fetchError{kind: parseErrorKind, err: fmt.Errorf("could not get raw exchange rates: %w", err)}
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	if len(fileNames) == 0 {
+		return &fetchError{kind: parseErrorKind, err: fmt.Errorf("no api part has %s", exchangeRatesFile)}
+	}
+	for _, fileName := range fileNames {
+		if err := getRawExchangeRatesStream(ctx, fileName, func(rawExchangeRate models.RawExchangeRate) {
+			if exchangeRate, ok := convert(rawExchangeRate); ok {
+				handle(exchangeRate, exchangerLabels[exchangeRate.ExchangerId])
+			}
+		}); err != nil {
+			return &fetchError{kind: parseErrorKind, err: fmt.Errorf("could not get raw exchange rates: %w", err)}
+		}
+	}
+	return nil
+}
 
-	replacer := strings.NewReplacer(" ", "_", "-", "_", "(", "", ")", "", "/", "", ".", "")
-	for _, exchangeRate := range exchangeRates {
-		{ //give rate
-			bestchageGiveRate.WithLabelValues([]string{
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.ExchangerName)),
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.SourceCurrency)),
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.TargetCurrency)),
-			}...).Observe(exchangeRate.GiveRate)
+// mergeParts reads the currencies or exchangers file of every api part that
+// has one, the names of an earlier part win over the ones of a later part
+func (b Bestchange) mergeParts(name string, read func(string) (map[int]string, error)) (map[int]string, error) {
+	var merged map[int]string
+	for part := range b.apiUrls() {
+		names, err := read(b.paths.apiFile(part, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
 		}
-		{ //get rate
-			bestchageGetRate.WithLabelValues([]string{
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.ExchangerName)),
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.SourceCurrency)),
-				replacer.Replace(iuliia.Wikipedia.Translate(exchangeRate.TargetCurrency)),
-			}...).Observe(exchangeRate.GetRate)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = names
+			continue
+		}
+		for id, value := range names {
+			if _, ok := merged[id]; !ok {
+				merged[id] = value
+			}
 		}
 	}
-	log.Printf("bestchange api data is successfully gathered: %v", time.Now())
+	if merged == nil {
+		return nil, fmt.Errorf("no api part has %s", name)
+	}
+	return merged, nil
+}
+
+func (b Bestchange) validRate(exchangeRate models.ExchangeRate) bool {
+	bounds := b.config.RateBounds
+	if bounds == nil {
+		return true
+	}
+	return inBounds(exchangeRate.GiveRate, bounds.MinGiveRate, bounds.MaxGiveRate) &&
+		inBounds(exchangeRate.GetRate, bounds.MinGetRate, bounds.MaxGetRate)
+}
+
+func inBounds(value, minimum, maximum float64) bool {
+	if minimum != 0 && value < minimum {
+		return false
+	}
+	if maximum != 0 && value > maximum {
+		return false
+	}
+	return true
 }
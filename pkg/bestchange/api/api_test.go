@@ -0,0 +1,328 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/bestchange/models"
+)
+
+// zipFiles returns a zip archive of the files by name
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("could not add %s to the zip: %s", name, err.Error())
+		}
+		if _, err = io.WriteString(file, content); err != nil {
+			t.Fatalf("could not write %s to the zip: %s", name, err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("could not close the zip: %s", err.Error())
+	}
+	return archive.Bytes()
+}
+
+// serveZip answers every request with the archive
+func serveZip(t *testing.T, archive []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestBestchange downloads and extracts the api parts into a temporary directory
+func newTestBestchange(t *testing.T, cfg configs.Bestchange, urls ...string) *Bestchange {
+	t.Helper()
+	dir := t.TempDir()
+	cfg.ApiUrls = urls
+	cfg.ZipFile = filepath.Join(dir, "bestChange.zip")
+	cfg.ExtractDir = filepath.Join(dir, "bestChange")
+	b, err := NewBestchangeParser(cfg)
+	if err != nil {
+		t.Fatalf("could not create bestchange: %s", err.Error())
+	}
+	b.UseLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return b
+}
+
+// rateKeys returns the rates as sorted exchanger:source>target keys
+func rateKeys(rates []models.ExchangeRate) []string {
+	keys := make([]string, 0, len(rates))
+	for _, rate := range rates {
+		keys = append(keys, rate.ExchangerName+":"+rate.SourceCurrency+">"+rate.TargetCurrency)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestFetchExchangeRatesParts(t *testing.T) {
+	first := serveZip(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile:    "1;2;10;1;30000;5;0.100\n",
+	}))
+	second := serveZip(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Renamed\n3;0;Ruble\n",
+		exchangerOfficesFile: "10;Renamed\n20;Second\n",
+		exchangeRatesFile:    "2;3;20;1;95;5;0.50\n1;3;10;1;2800000;5;0.7\n",
+	}))
+	tests := []struct {
+		name string
+		urls []string
+		want []string
+	}{
+		{
+			name: "single part",
+			urls: []string{first.URL},
+			want: []string{"First:Bitcoin>Tether"},
+		},
+		{
+			name: "every part is parsed and the first one names",
+			urls: []string{first.URL, second.URL},
+			want: []string{"First:Bitcoin>Ruble", "First:Bitcoin>Tether", "Second:Tether>Ruble"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBestchange(t, configs.Bestchange{}, tt.urls...)
+
+			var rates []models.ExchangeRate
+			fetchErr := b.fetchExchangeRates(context.Background(), func(rate models.ExchangeRate, _ string) {
+				rates = append(rates, rate)
+			})
+			if fetchErr != nil {
+				t.Fatalf("could not fetch the rates: %s", fetchErr.Error())
+			}
+			got := rateKeys(rates)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got rates %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got rates %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchExchangeRatesMalformed(t *testing.T) {
+	valid := serveZip(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile:    "1;2;10;1;30000;5;0.100\n",
+	}))
+	malformed := serveZip(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile:    "2;1;10;30000;1;5;0.100\n2;1;ten;30000;1;5;0\n",
+	}))
+	tests := []struct {
+		name string
+		urls []string
+	}{
+		{name: "malformed line after a valid one", urls: []string{malformed.URL}},
+		{name: "malformed part after a valid part", urls: []string{valid.URL, malformed.URL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBestchange(t, configs.Bestchange{}, tt.urls...)
+
+			var rates int
+			fetchErr := b.fetchExchangeRates(context.Background(), func(models.ExchangeRate, string) {
+				rates++
+			})
+			if fetchErr == nil || fetchErr.kind != parseErrorKind {
+				t.Fatalf("got error %v, want a %s error", fetchErr, parseErrorKind)
+			}
+			if rates != 0 {
+				t.Errorf("got %d rates handed on, want none of a malformed download", rates)
+			}
+		})
+	}
+}
+
+// conditionalServer answers a request carrying the etag of the archive with 304 Not Modified
+func conditionalServer(t *testing.T, archive []byte, conditional *atomic.Int32) *httptest.Server {
+	t.Helper()
+	const etag = `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetApiPartsMaxExtractAge(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxExtractAge   time.Duration
+		wantConditional int32
+	}{
+		{name: "fresh files are reused", maxExtractAge: time.Hour, wantConditional: 1},
+		{name: "old files are downloaded again", maxExtractAge: time.Nanosecond, wantConditional: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conditional atomic.Int32
+			server := conditionalServer(t, zipFiles(t, map[string]string{exchangeRatesFile: ""}), &conditional)
+			b := newTestBestchange(t, configs.Bestchange{}, server.URL)
+			b.maxExtractAge = tt.maxExtractAge
+
+			for i := 0; i < 2; i++ {
+				if _, fetchErr := b.getApiParts(context.Background()); fetchErr != nil {
+					t.Fatalf("could not get the api parts: %s", fetchErr.Error())
+				}
+			}
+			if got := conditional.Load(); got != tt.wantConditional {
+				t.Errorf("got %d conditional requests, want %d", got, tt.wantConditional)
+			}
+			if _, err := os.Stat(b.paths.apiFile(0, exchangeRatesFile)); err != nil {
+				t.Errorf("the extracted file is missing: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestFetchExchangeRatesPairFilter(t *testing.T) {
+	server := serveZip(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n3;0;Ruble\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile: "1;2;10;1;30000;5;0.1\n1;3;10;1;2800000;5;0.1\n2;1;10;30000;1;5;0.1\n" +
+			"2;3;10;1;95;5;0.1\n3;1;10;2800000;1;5;0.1\n3;2;10;95;1;5;0.1\n",
+	}))
+	tests := []struct {
+		name  string
+		pairs []configs.BestchangePair
+		want  []string
+	}{
+		{
+			name: "no filter keeps every pair",
+			want: []string{
+				"First:Bitcoin>Ruble", "First:Bitcoin>Tether", "First:Ruble>Bitcoin",
+				"First:Ruble>Tether", "First:Tether>Bitcoin", "First:Tether>Ruble",
+			},
+		},
+		{
+			name:  "a single pair",
+			pairs: []configs.BestchangePair{{Source: "Bitcoin", Target: "Ruble"}},
+			want:  []string{"First:Bitcoin>Ruble"},
+		},
+		{
+			name:  "the direction matters",
+			pairs: []configs.BestchangePair{{Source: "Ruble", Target: "Tether"}, {Source: "Ruble", Target: "Dollar"}},
+			want:  []string{"First:Ruble>Tether"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBestchange(t, configs.Bestchange{Pairs: tt.pairs}, server.URL)
+
+			var rates []models.ExchangeRate
+			fetchErr := b.fetchExchangeRates(context.Background(), func(rate models.ExchangeRate, _ string) {
+				rates = append(rates, rate)
+			})
+			if fetchErr != nil {
+				t.Fatalf("could not fetch the rates: %s", fetchErr.Error())
+			}
+			if got := rateKeys(rates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got rates %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchExchangeRatesNotModified(t *testing.T) {
+	var conditional atomic.Int32
+	server := conditionalServer(t, zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile:    "1;2;10;1;30000;5;0.100\n",
+	}), &conditional)
+	b := newTestBestchange(t, configs.Bestchange{}, server.URL)
+
+	var extractedAt time.Time
+	for i := 0; i < 2; i++ {
+		var rates []models.ExchangeRate
+		fetchErr := b.fetchExchangeRates(context.Background(), func(rate models.ExchangeRate, _ string) {
+			rates = append(rates, rate)
+		})
+		if fetchErr != nil {
+			t.Fatalf("fetch %d: could not fetch the rates: %s", i, fetchErr.Error())
+		}
+		if got, want := rateKeys(rates), []string{"First:Bitcoin>Tether"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("fetch %d: got rates %v, want %v", i, got, want)
+		}
+		info, err := os.Stat(b.paths.apiFile(0, exchangeRatesFile))
+		if err != nil {
+			t.Fatalf("fetch %d: the extracted file is missing: %s", i, err.Error())
+		}
+		if i == 0 {
+			extractedAt = info.ModTime()
+		} else if !info.ModTime().Equal(extractedAt) {
+			t.Errorf("the files were extracted again after a 304")
+		}
+	}
+	if got := conditional.Load(); got != 1 {
+		t.Errorf("got %d answers of 304, want 1", got)
+	}
+	if _, err := os.Stat(b.paths.partZipFile(0)); !os.IsNotExist(err) {
+		t.Errorf("got the zip file kept after a 304, err %v", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	archive := zipFiles(t, map[string]string{
+		currenciesFile:       "1;0;Bitcoin\n2;0;Tether\n",
+		exchangerOfficesFile: "10;First\n",
+		exchangeRatesFile:    "1;2;10;1;30000;5;0.100\n",
+	})
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "api.bestchange.test" {
+			t.Errorf("got a proxied request for %s, want one for the api url", r.URL)
+		}
+		proxied.Add(1)
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(proxy.Close)
+	// the api url does not resolve, only the proxy can answer
+	b := newTestBestchange(t, configs.Bestchange{Proxy: proxy.URL}, "http://api.bestchange.test/info.zip")
+
+	var rates []models.ExchangeRate
+	fetchErr := b.fetchExchangeRates(context.Background(), func(rate models.ExchangeRate, _ string) {
+		rates = append(rates, rate)
+	})
+	if fetchErr != nil {
+		t.Fatalf("could not fetch the rates: %s", fetchErr.Error())
+	}
+	if len(rates) != 1 || proxied.Load() != 1 {
+		t.Errorf("got %d rates through %d proxied requests, want one", len(rates), proxied.Load())
+	}
+}
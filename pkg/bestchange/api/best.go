@@ -0,0 +1,100 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/bestchange/models"
+)
+
+func init() {
+	prometheus.MustRegister(bestchangeBestExchanger)
+}
+
+var bestchangeBestExchanger = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "bestchange",
+		Name:      "best_exchanger",
+		Help:      "1 for the exchanger giving the most of the target currency per source currency of a pair.",
+	},
+	bcLabels,
+)
+
+// bestExchangers remembers the exported winner of every pair
+// so its series is removed once another exchanger wins
+type bestExchangers struct {
+	pairs []configs.BestchangePair
+
+	mu      sync.Mutex
+	winners map[configs.BestchangePair][]string
+}
+
+func newBestExchangers(pairs []configs.BestchangePair) *bestExchangers {
+	return &bestExchangers{
+		pairs:   pairs,
+		winners: make(map[configs.BestchangePair][]string),
+	}
+}
+
+// bestRate is the best rate of a pair seen so far and the label of its exchanger
+type bestRate struct {
+	rate           models.ExchangeRate
+	exchangerLabel string
+}
+
+// bestRates keeps the best rate of every listed pair while the rates of a scrape stream by
+type bestRates struct {
+	wanted map[configs.BestchangePair]bool
+	rates  map[configs.BestchangePair]bestRate
+}
+
+func (b Bestchange) newBestRates() bestRates {
+	wanted := make(map[configs.BestchangePair]bool, len(b.best.pairs))
+	for _, pair := range b.best.pairs {
+		wanted[pair] = true
+	}
+	return bestRates{wanted: wanted, rates: make(map[configs.BestchangePair]bestRate)}
+}
+
+// add takes a valid rate into account
+func (r bestRates) add(rate models.ExchangeRate, exchangerLabel string) {
+	pair := configs.BestchangePair{Source: rate.SourceCurrency, Target: rate.TargetCurrency}
+	if !r.wanted[pair] || rate.GiveRate <= 0 {
+		return
+	}
+	best, ok := r.rates[pair]
+	if !ok || rate.GetRate/rate.GiveRate > best.rate.GetRate/best.rate.GiveRate {
+		r.rates[pair] = bestRate{rate: rate, exchangerLabel: exchangerLabel}
+	}
+}
+
+func (b Bestchange) observeBestExchangers(bests bestRates) {
+	if len(b.best.pairs) == 0 {
+		return
+	}
+
+	b.best.mu.Lock()
+	defer b.best.mu.Unlock()
+	for _, pair := range b.best.pairs {
+		previous, hadWinner := b.best.winners[pair]
+		best, ok := bests.rates[pair]
+		if !ok {
+			if hadWinner {
+				bestchangeBestExchanger.DeleteLabelValues(previous...)
+				delete(b.best.winners, pair)
+			}
+			continue
+		}
+		labels := []string{
+			best.exchangerLabel,
+			b.labelMapper.Map(best.rate.SourceCurrency),
+			b.labelMapper.Map(best.rate.TargetCurrency),
+		}
+		if hadWinner && previous[0] != labels[0] {
+			bestchangeBestExchanger.DeleteLabelValues(previous...)
+		}
+		bestchangeBestExchanger.WithLabelValues(labels...).Set(1)
+		b.best.winners[pair] = labels
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"archive/zip"
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,48 +11,160 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/slvic/stock-observer/internal/configs"
 	"github.com/slvic/stock-observer/pkg/bestchange/models"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
 )
 
 const (
-	bcApiZipFileName = `bestChange.zip`
-	bcApiFolder      = `bestChange`
+	defaultZipFile    = `bestChange.zip`
+	defaultExtractDir = `bestChange`
 )
 
+// names of the api files inside the zip
 const (
-	currenciesFile       = `bestChange/bm_cy.dat`
-	exchangerOfficesFile = `bestChange/bm_exch.dat`
-	exchangeRatesFile    = `bestChange/bm_rates.dat`
+	currenciesFile       = `bm_cy.dat`
+	exchangerOfficesFile = `bm_exch.dat`
+	exchangeRatesFile    = `bm_rates.dat`
 
 	dataSeparator = `;`
 )
 
-func (b Bestchange) getBcApiFile() error {
+// paths are the files of a single Bestchange instance
+type paths struct {
+	zipFile    string
+	extractDir string
+}
+
+func newPaths(cfg configs.Bestchange) paths {
+	p := paths{zipFile: cfg.ZipFile, extractDir: cfg.ExtractDir}
+	if p.zipFile == "" {
+		p.zipFile = defaultZipFile
+	}
+	if p.extractDir == "" {
+		p.extractDir = defaultExtractDir
+	}
+	return p
+}
+
+// partZipFile is the zip file of the i-th api part
+func (p paths) partZipFile(i int) string {
+	if i == 0 {
+		return p.zipFile
+	}
+	ext := filepath.Ext(p.zipFile)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(p.zipFile, ext), i, ext)
+}
+
+// partExtractDir is where the i-th api part is extracted to, every part has
+// its own directory so that the same-named files of the parts never mix
+func (p paths) partExtractDir(i int) string {
+	if i == 0 {
+		return p.extractDir
+	}
+	return fmt.Sprintf("%s_%d", p.extractDir, i)
+}
+
+func (p paths) apiFile(part int, name string) string {
+	return filepath.Join(p.partExtractDir(part), name)
+}
+
+// getBcApiFile downloads an api zip to fileName and returns the time the data
+// was last modified upstream, falling back to the download time; the request is
+// conditional on the validators of the last extracted download of the url unless
+// it was extracted more than maxExtractAge ago, changed is false when the server
+// answered 304 Not Modified
+func (b Bestchange) getBcApiFile(ctx context.Context, url, fileName string) (dataTime time.Time, changed bool, err error) {
+	downloadTime := time.Now()
 
-	resp, err := b.httpClient.Get(b.config.ApiUrl)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("could not get bc api file: %w", err)
+		return time.Time{}, false, fmt.Errorf("could not create a request: %w", err)
+	}
+	cached, isCached := b.downloads.get(url, b.maxExtractAge)
+	if isCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("could not get bc api file: %w", err)
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		b.latency.Observe(time.Since(downloadTime))
+		return cached.dataTime, false, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("wrong responce status code: %d", resp.StatusCode)
+		return time.Time{}, false, fmt.Errorf("wrong responce status code: %d", resp.StatusCode)
 	}
 
-	out, err := os.Create(bcApiZipFileName)
+	out, err := os.Create(fileName)
 	if err != nil {
-		return fmt.Errorf("could not create zip file: %w", err)
+		return time.Time{}, false, fmt.Errorf("could not create zip file: %w", err)
 	}
 	defer out.Close()
 
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
-		return fmt.Errorf("could not write responce body to a zip file: %w", err)
+		_ = os.Remove(fileName)
+		return time.Time{}, false, fmt.Errorf("could not write responce body to a zip file: %w", err)
+	}
+	b.latency.Observe(time.Since(downloadTime))
+
+	dataTime = downloadTime
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		dataTime = lastModified
+	}
+	b.downloads.pending(url, download{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		dataTime:     dataTime,
+	})
+	return dataTime, true, nil
+}
+
+// extract unzips source into a temporary directory next to destination and
+// moves the files into destination only once every file is written,
+// so a failed extraction never leaves half-written files behind;
+// the zip and the temporary directory are removed afterwards
+func extract(source, destination string) error {
+	defer os.Remove(source)
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("could not create the extraction folder: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(destination), ".extract-*")
+	if err != nil {
+		return fmt.Errorf("could not create a temporary extraction folder: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err = unzipSource(source, tempDir); err != nil {
+		return err
 	}
 
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return fmt.Errorf("could not read the temporary extraction folder: %w", err)
+	}
+	for _, entry := range entries {
+		target := filepath.Join(destination, entry.Name())
+		if err = os.RemoveAll(target); err != nil {
+			return fmt.Errorf("could not remove the stale %s: %w", target, err)
+		}
+		if err = os.Rename(filepath.Join(tempDir, entry.Name()), target); err != nil {
+			return fmt.Errorf("could not move the extracted %s: %w", entry.Name(), err)
+		}
+	}
 	return nil
 }
 
@@ -77,10 +190,18 @@ func unzipSource(source, destination string) error {
 	return nil
 }
 
+// unzipFile refuses entries that would end up outside of destination:
+// absolute names, names escaping it with .. and symlinks
 func unzipFile(f *zip.File, destination string) error {
-	filePath := filepath.Join(destination, f.Name)
+	if filepath.IsAbs(f.Name) || strings.HasPrefix(f.Name, "/") || strings.HasPrefix(f.Name, `\`) {
+		return fmt.Errorf("invalid file path: %s", f.Name)
+	}
+	filePath := filepath.Join(destination, filepath.Clean(f.Name))
 	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
-		return fmt.Errorf("invalid file path: %s", filePath)
+		return fmt.Errorf("invalid file path: %s", f.Name)
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("symlinks are not allowed: %s", f.Name)
 	}
 
 	if f.FileInfo().IsDir() {
@@ -94,7 +215,7 @@ func unzipFile(f *zip.File, destination string) error {
 		return fmt.Errorf("clould not create a file: %w", err)
 	}
 
-	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
 	if err != nil {
 		return fmt.Errorf("could not open a file: %w", err)
 	}
@@ -113,19 +234,56 @@ func unzipFile(f *zip.File, destination string) error {
 	return nil
 }
 
-func getExchangeRates(
-	rawExchangeRates []models.RawExchangeRate,
+// rateConverter returns a func converting a raw exchange rate,
+// it is not ok for rates of currencies outside of currencyIds
+// and for rates of pairs that are not listed
+func (b Bestchange) rateConverter(
 	exchangers map[int]string,
 	currencies map[int]string,
-) []models.ExchangeRate {
+) func(models.RawExchangeRate) (models.ExchangeRate, bool) {
+	allowedCurrencies := make(map[int]struct{}, len(b.config.CurrencyIDs))
+	for _, currencyId := range b.config.CurrencyIDs {
+		allowedCurrencies[currencyId] = struct{}{}
+	}
 
-	var exchangeRates []models.ExchangeRate
+	mergedCurrencies := make(map[int]string)
+	for _, merge := range b.config.Merges {
+		for _, currencyId := range merge.CurrencyIDs {
+			mergedCurrencies[currencyId] = merge.Name
+		}
+	}
+	currencyName := func(currencyId int) string {
+		if name, ok := mergedCurrencies[currencyId]; ok {
+			return name
+		}
+		return currencies[currencyId]
+	}
+
+	allowedPairs := make(map[configs.BestchangePair]struct{}, len(b.config.Pairs))
+	for _, pair := range b.config.Pairs {
+		allowedPairs[pair] = struct{}{}
+	}
 
-	for _, rawExchangeRate := range rawExchangeRates {
+	return func(rawExchangeRate models.RawExchangeRate) (models.ExchangeRate, bool) {
 		var exchangeRate models.ExchangeRate
 
-		exchangeRate.SourceCurrency = currencies[rawExchangeRate.SourceCurrencyId]
-		exchangeRate.TargetCurrency = currencies[rawExchangeRate.TargetCurrencyId]
+		if len(allowedCurrencies) != 0 {
+			_, sourceAllowed := allowedCurrencies[rawExchangeRate.SourceCurrencyId]
+			_, targetAllowed := allowedCurrencies[rawExchangeRate.TargetCurrencyId]
+			if !sourceAllowed || !targetAllowed {
+				return models.ExchangeRate{}, false
+			}
+		}
+
+		exchangeRate.SourceCurrency = currencyName(rawExchangeRate.SourceCurrencyId)
+		exchangeRate.TargetCurrency = currencyName(rawExchangeRate.TargetCurrencyId)
+		if len(allowedPairs) != 0 {
+			pair := configs.BestchangePair{Source: exchangeRate.SourceCurrency, Target: exchangeRate.TargetCurrency}
+			if _, ok := allowedPairs[pair]; !ok {
+				return models.ExchangeRate{}, false
+			}
+		}
+		exchangeRate.ExchangerId = rawExchangeRate.ExchangersId
 		exchangeRate.ExchangerName = exchangers[rawExchangeRate.ExchangersId]
 		exchangeRate.GiveRate = rawExchangeRate.GiveRate
 		exchangeRate.GetRate = rawExchangeRate.GetRate
@@ -133,10 +291,8 @@ func getExchangeRates(
 		exchangeRate.GoodReviewsCount = rawExchangeRate.GoodReviewsCount
 		exchangeRate.BadReviewsCount = rawExchangeRate.BadReviewsCount
 
-		exchangeRates = append(exchangeRates, exchangeRate)
+		return exchangeRate, true
 	}
-
-	return exchangeRates
 }
 
 func getRawCurrencies(fileName string) (map[int]string, error) {
@@ -212,82 +368,114 @@ func getRawExchangers(fileName string) (map[int]string, error) {
 	return exchangers, nil
 }
 
+// getRawExchangeRates returns every rate of the rates file, nothing is
+// returned when a line is malformed
 func getRawExchangeRates(fileName string) ([]models.RawExchangeRate, error) {
 	var exchangeRates []models.RawExchangeRate
+	err := getRawExchangeRatesStream(context.Background(), fileName, func(exchangeRate models.RawExchangeRate) {
+		exchangeRates = append(exchangeRates, exchangeRate)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exchangeRates, nil
+}
+
+// checkRawExchangeRates parses the rates file without keeping any rate
+func checkRawExchangeRates(ctx context.Context, fileName string) error {
+	return getRawExchangeRatesStream(ctx, fileName, func(models.RawExchangeRate) {})
+}
 
+// getRawExchangeRatesStream parses the rates file line by line and hands every
+// rate to handle, so the rates are never held at once; it stops at the first
+// malformed line or once ctx is done, after the rates before it were handled,
+// so a file that must not be published in part is checked first
+func getRawExchangeRatesStream(ctx context.Context, fileName string, handle func(models.RawExchangeRate)) error {
 	fileName, err := filepath.Abs(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("could not get absolute file path: %w", err)
+		return fmt.Errorf("could not get absolute file path: %w", err)
 	}
 	file, err := os.Open(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("could not open a file: %w", err)
+		return fmt.Errorf("could not open a file: %w", err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-
 	for scanner.Scan() {
-		var exchangeRate models.RawExchangeRate
-
-		currencyData := strings.Split(scanner.Text(), dataSeparator)
-
-		exchangeRate.SourceCurrencyId, err = strconv.Atoi(currencyData[0])
-		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange rate source currency id string to integer: %w", err)
+		if err = ctx.Err(); err != nil {
+			return err
 		}
-
-		exchangeRate.TargetCurrencyId, err = strconv.Atoi(currencyData[1])
+		exchangeRate, err := parseRawExchangeRate(scanner.Text())
 		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange rate target source id string to integer: %w", err)
+			return err
 		}
+		handle(exchangeRate)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("a scanner error: %w", err)
+	}
+	return nil
+}
 
-		exchangeRate.ExchangersId, err = strconv.Atoi(currencyData[2])
-		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange rate exchanger's id string to integer: %w", err)
-		}
+func parseRawExchangeRate(line string) (models.RawExchangeRate, error) {
+	var exchangeRate models.RawExchangeRate
+	var err error
 
-		exchangeRate.GiveRate, err = strconv.ParseFloat(currencyData[3], 64)
-		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange give rate string to integer: %w", err)
-		}
+	currencyData := strings.Split(line, dataSeparator)
+	if len(currencyData) < 7 {
+		return models.RawExchangeRate{}, fmt.Errorf("exchange rate has %d fields, want at least 7", len(currencyData))
+	}
 
-		exchangeRate.GetRate, err = strconv.ParseFloat(currencyData[4], 64)
-		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange get rate string to integer: %w", err)
-		}
+	exchangeRate.SourceCurrencyId, err = strconv.Atoi(currencyData[0])
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate source currency id string to integer: %w", err)
+	}
 
-		exchangeRate.TargetCurrencyReserve, err = strconv.ParseFloat(currencyData[5], 64)
-		if err != nil {
-			return nil, fmt.Errorf("could not convert exchange rate target currency reserve string to integer: %w", err)
-		}
+	exchangeRate.TargetCurrencyId, err = strconv.Atoi(currencyData[1])
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate target source id string to integer: %w", err)
+	}
 
-		reviews := strings.Split(currencyData[6], ".")
-		switch len(reviews) {
-		case 1:
-			exchangeRate.GoodReviewsCount, err = strconv.Atoi(reviews[0])
-			if err != nil {
-				return nil, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
-			}
-		case 2:
-			exchangeRate.GoodReviewsCount, err = strconv.Atoi(reviews[1])
-			if err != nil {
-				return nil, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
-			}
-			exchangeRate.BadReviewsCount, err = strconv.Atoi(reviews[0])
-			if err != nil {
-				return nil, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
-			}
-		default:
-			return nil, fmt.Errorf("unsupported reviews count format, there are %d review types", len(reviews))
-		}
+	exchangeRate.ExchangersId, err = strconv.Atoi(currencyData[2])
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate exchanger's id string to integer: %w", err)
+	}
 
-		exchangeRates = append(exchangeRates, exchangeRate)
+	exchangeRate.GiveRate, err = strconv.ParseFloat(currencyData[3], 64)
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange give rate string to integer: %w", err)
 	}
 
-	if err = scanner.Err(); err != nil {
-		return nil, fmt.Errorf("a scanner error: %w", err)
+	exchangeRate.GetRate, err = strconv.ParseFloat(currencyData[4], 64)
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange get rate string to integer: %w", err)
 	}
 
-	return exchangeRates, nil
+	exchangeRate.TargetCurrencyReserve, err = strconv.ParseFloat(currencyData[5], 64)
+	if err != nil {
+		return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate target currency reserve string to integer: %w", err)
+	}
+
+	reviews := strings.Split(currencyData[6], ".")
+	switch len(reviews) {
+	case 1:
+		exchangeRate.GoodReviewsCount, err = strconv.Atoi(reviews[0])
+		if err != nil {
+			return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
+		}
+	case 2:
+		exchangeRate.GoodReviewsCount, err = strconv.Atoi(reviews[1])
+		if err != nil {
+			return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
+		}
+		exchangeRate.BadReviewsCount, err = strconv.Atoi(reviews[0])
+		if err != nil {
+			return models.RawExchangeRate{}, fmt.Errorf("could not convert exchange rate revievs count string to integer: %w", err)
+		}
+	default:
+		return models.RawExchangeRate{}, fmt.Errorf("unsupported reviews count format, there are %d review types", len(reviews))
+	}
+
+	return exchangeRate, nil
 }
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slvic/stock-observer/pkg/bestchange/models"
+)
+
+// writeRatesFile writes a rates file of n distinct rates
+func writeRatesFile(t testing.TB, n int) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), exchangeRatesFile)
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatalf("could not create the rates file: %s", err.Error())
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(writer, "%d;%d;%d;1;%d.%d;%d.5;%d.%d\n", i%300, (i+1)%300, i%500, 90+i%10, i%100, i, i%7, i%1000)
+	}
+	if err = writer.Flush(); err != nil {
+		t.Fatalf("could not write the rates file: %s", err.Error())
+	}
+	return fileName
+}
+
+func TestGetRawExchangeRatesStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		cancelled bool
+		wantRates int
+		wantErr   bool
+	}{
+		{name: "every rate", content: "1;2;10;1;90;5;0.100\n2;1;10;90;1;5;3\n", wantRates: 2},
+		{name: "empty file", content: "", wantRates: 0},
+		{name: "malformed line", content: "1;2;10;1;90;5;0.100\n1;2;ten;1;90;5;0\n2;1;10;90;1;5;3\n", wantRates: 1, wantErr: true},
+		{name: "missing fields", content: "1;2;10;1\n", wantErr: true},
+		{name: "cancelled", content: "1;2;10;1;90;5;0.100\n", cancelled: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), exchangeRatesFile)
+			if err := os.WriteFile(fileName, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("could not write the rates file: %s", err.Error())
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelled {
+				cancel()
+			}
+			defer cancel()
+
+			var rates int
+			err := getRawExchangeRatesStream(ctx, fileName, func(models.RawExchangeRate) {
+				rates++
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if rates != tt.wantRates {
+				t.Errorf("got %d rates, want %d", rates, tt.wantRates)
+			}
+		})
+	}
+}
+
+func TestGetRawExchangeRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantRates int
+		wantErr   bool
+	}{
+		{name: "every rate", content: "1;2;10;1;90;5;0.100\n2;1;10;90;1;5;3\n", wantRates: 2},
+		{name: "malformed line returns no rate", content: "1;2;10;1;90;5;0.100\n1;2;ten;1;90;5;0\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), exchangeRatesFile)
+			if err := os.WriteFile(fileName, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("could not write the rates file: %s", err.Error())
+			}
+			rates, err := getRawExchangeRates(fileName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if len(rates) != tt.wantRates {
+				t.Errorf("got %d rates, want %d", len(rates), tt.wantRates)
+			}
+		})
+	}
+}
+
+// benchmarkRates is the number of lines of the benchmarked rates file,
+// about the size of the full bestchange dataset
+const benchmarkRates = 100000
+
+func BenchmarkGetRawExchangeRates(b *testing.B) {
+	fileName := writeRatesFile(b, benchmarkRates)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rates, err := getRawExchangeRates(fileName)
+		if err != nil {
+			b.Fatalf("could not parse the rates: %s", err.Error())
+		}
+		if len(rates) != benchmarkRates {
+			b.Fatalf("parsed %d rates, want %d", len(rates), benchmarkRates)
+		}
+	}
+}
+
+func BenchmarkGetRawExchangeRatesStream(b *testing.B) {
+	fileName := writeRatesFile(b, benchmarkRates)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var parsed int
+		if err := getRawExchangeRatesStream(context.Background(), fileName, func(models.RawExchangeRate) {
+			parsed++
+		}); err != nil {
+			b.Fatalf("could not parse the rates: %s", err.Error())
+		}
+		if parsed != benchmarkRates {
+			b.Fatalf("parsed %d rates, want %d", parsed, benchmarkRates)
+		}
+	}
+}
+
+// zipEntry is a file of a test archive, mode is that of a regular file when zero
+type zipEntry struct {
+	name string
+	mode os.FileMode
+}
+
+// writeZip writes an archive of the entries into dir
+func writeZip(t *testing.T, dir string, entries ...zipEntry) string {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Store}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		header.SetMode(mode)
+		file, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("could not add %s to the zip: %s", entry.name, err.Error())
+		}
+		if _, err = io.WriteString(file, "payload"); err != nil {
+			t.Fatalf("could not write %s to the zip: %s", entry.name, err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("could not close the zip: %s", err.Error())
+	}
+	source := filepath.Join(dir, "api.zip")
+	if err := os.WriteFile(source, archive.Bytes(), 0o600); err != nil {
+		t.Fatalf("could not write the zip: %s", err.Error())
+	}
+	return source
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   zipEntry
+		wantErr bool
+	}{
+		{name: "regular file", entry: zipEntry{name: exchangeRatesFile}},
+		{name: "nested file", entry: zipEntry{name: "nested/" + exchangeRatesFile}},
+		{name: "parent traversal", entry: zipEntry{name: "../../escaped.dat"}, wantErr: true},
+		{name: "traversal through a folder", entry: zipEntry{name: "nested/../../escaped.dat"}, wantErr: true},
+		{name: "absolute path", entry: zipEntry{name: "/escaped.dat"}, wantErr: true},
+		{name: "symlink", entry: zipEntry{name: "link.dat", mode: os.ModeSymlink | 0o777}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			destination := filepath.Join(root, "a", "b", "bestChange")
+			if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+				t.Fatalf("could not create the destination parent: %s", err.Error())
+			}
+			source := writeZip(t, root, tt.entry)
+
+			err := extract(source, destination)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			escaped := []string{
+				filepath.Join(root, "escaped.dat"),
+				filepath.Join(root, "a", "escaped.dat"),
+				filepath.Join(root, "a", "b", "escaped.dat"),
+				"/escaped.dat",
+			}
+			for _, path := range escaped {
+				if _, statErr := os.Stat(path); statErr == nil {
+					t.Errorf("the entry was written outside of the destination to %s", path)
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+			content, readErr := os.ReadFile(filepath.Join(destination, tt.entry.name))
+			if readErr != nil || string(content) != "payload" {
+				t.Errorf("got extracted content %q and error %v, want the payload", content, readErr)
+			}
+		})
+	}
+}
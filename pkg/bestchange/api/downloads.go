@@ -0,0 +1,59 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// download holds the validators of a downloaded api zip
+// and the time its files were extracted
+type download struct {
+	etag         string
+	lastModified string
+	dataTime     time.Time
+	extractedAt  time.Time
+}
+
+// downloads remembers the validators of the api zips whose files were
+// extracted, so that an unchanged zip is neither downloaded nor extracted again
+type downloads struct {
+	mu        sync.Mutex
+	extracted map[string]download
+	received  map[string]download
+}
+
+func newDownloads() *downloads {
+	return &downloads{
+		extracted: make(map[string]download),
+		received:  make(map[string]download),
+	}
+}
+
+// get returns the download of the url unless its files were extracted more than maxAge ago
+func (d *downloads) get(url string, maxAge time.Duration) (download, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cached, ok := d.extracted[url]
+	if ok && time.Since(cached.extractedAt) > maxAge {
+		return download{}, false
+	}
+	return cached, ok
+}
+
+// pending keeps the validators of a received zip until it is extracted
+func (d *downloads) pending(url string, received download) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.extracted, url)
+	d.received[url] = received
+}
+
+func (d *downloads) extractedFrom(url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if received, ok := d.received[url]; ok {
+		received.extractedAt = time.Now()
+		d.extracted[url] = received
+		delete(d.received, url)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mehanizm/iuliia-go"
+)
+
+// LabelMapper turns bestchange exchanger and currency names into label values
+type LabelMapper interface {
+	Map(string) string
+}
+
+// noTransliteration keeps names as they are, for already latin names
+const noTransliteration = "none"
+
+// transliterations are the supported iuliia schemes by name
+var transliterations = map[string]*iuliia.Schema{
+	iuliia.Wikipedia.Name:     iuliia.Wikipedia,
+	iuliia.Icao_doc_9303.Name: iuliia.Icao_doc_9303,
+	iuliia.Gost_52535.Name:    iuliia.Gost_52535,
+	iuliia.Gost_7034.Name:     iuliia.Gost_7034,
+	iuliia.Mosmetro.Name:      iuliia.Mosmetro,
+	iuliia.Scientific.Name:    iuliia.Scientific,
+	iuliia.Telegram.Name:      iuliia.Telegram,
+	iuliia.Yandex_money.Name:  iuliia.Yandex_money,
+}
+
+var labelReplacer = strings.NewReplacer(" ", "_", "-", "_", "(", "", ")", "", "/", "", ".", "")
+
+// sanitizeLabel replaces spaces and dashes with underscores
+// and drops parens, slashes and dots
+func sanitizeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+type transliterationMapper struct {
+	schema *iuliia.Schema
+}
+
+// newTransliterationMapper uses the named iuliia scheme, wikipedia when empty
+func newTransliterationMapper(scheme string) (transliterationMapper, error) {
+	if scheme == "" {
+		scheme = iuliia.Wikipedia.Name
+	}
+	if scheme == noTransliteration {
+		return transliterationMapper{}, nil
+	}
+	schema, ok := transliterations[scheme]
+	if !ok {
+		return transliterationMapper{}, fmt.Errorf("unknown transliteration scheme %q", scheme)
+	}
+	return transliterationMapper{schema: schema}, nil
+}
+
+func (m transliterationMapper) Map(value string) string {
+	if m.schema != nil {
+		value = m.schema.Translate(value)
+	}
+	return sanitizeLabel(value)
+}
+
+// staticMapper maps known names with a lookup table and falls back otherwise
+type staticMapper struct {
+	labels   map[string]string
+	fallback LabelMapper
+}
+
+func (m staticMapper) Map(value string) string {
+	if label, ok := m.labels[value]; ok {
+		return label
+	}
+	return m.fallback.Map(value)
+}
+
+func newLabelMapper(labels map[string]string, scheme string) (LabelMapper, error) {
+	mapper, err := newTransliterationMapper(scheme)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return mapper, nil
+	}
+	return staticMapper{
+		labels:   labels,
+		fallback: mapper,
+	}, nil
+}
+
+// exchangerLabels maps the exchanger names by id to label values, when several exchangers
+// end up with the same label all but the one with the lowest id get their id
+// appended so they stay distinct series
+func (b Bestchange) exchangerLabels(names map[int]string) map[int]string {
+	ids := make([]int, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	labels := make(map[int]string, len(ids))
+	owners := make(map[string]int, len(ids))
+	for _, id := range ids {
+		label := b.labelMapper.Map(names[id])
+		if owner, taken := owners[label]; taken {
+			b.logger.Warn("exchanger label collides", "exchangerId", id, "label", label, "ownerId", owner)
+			label = fmt.Sprintf("%s_%d", label, id)
+		}
+		owners[label] = id
+		labels[id] = label
+	}
+	return labels
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mehanizm/iuliia-go"
+)
+
+func TestSanitizeLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "spaces", value: "Visa MasterCard RUB", want: "Visa_MasterCard_RUB"},
+		{name: "dashes", value: "Obmen-ka", want: "Obmen_ka"},
+		{name: "slashes", value: "Visa/MasterCard", want: "VisaMasterCard"},
+		{name: "parens", value: "Tether TRC20 (USDT)", want: "Tether_TRC20_USDT"},
+		{name: "dots", value: "obmen.net", want: "obmennet"},
+		{name: "already sanitized", value: "Sberbank", want: "Sberbank"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeLabel(tt.value); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelMapper(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		scheme  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "cyrillic with the default scheme", value: "Сбербанк", want: "Sberbank"},
+		{name: "cyrillic with spaces and parens", value: "Тинькофф (RUB)", want: "Tinkoff_RUB"},
+		{name: "another scheme", scheme: iuliia.Icao_doc_9303.Name, value: "Юмани", want: "Iumani"},
+		{name: "no transliteration", scheme: noTransliteration, value: "Сбер банк", want: "Сбер_банк"},
+		{name: "static label", labels: map[string]string{"Сбербанк": "SBERRUB"}, value: "Сбербанк", want: "SBERRUB"},
+		{name: "static fallback", labels: map[string]string{"Сбербанк": "SBERRUB"}, value: "Альфа", want: "Alfa"},
+		{name: "unknown scheme", scheme: "klingon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper, err := newLabelMapper(tt.labels, tt.scheme)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := mapper.Map(tt.value); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangerLabelsCollision(t *testing.T) {
+	var logs bytes.Buffer
+	mapper, err := newLabelMapper(nil, "")
+	if err != nil {
+		t.Fatalf("could not create a label mapper: %s", err.Error())
+	}
+	b := Bestchange{labelMapper: mapper, logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	// both names sanitize to Obmen_ka, the lower id keeps the plain label
+	got := b.exchangerLabels(map[int]string{5: "Obmen-ka", 3: "Obmen ka", 7: "Обмен"})
+	want := map[int]string{3: "Obmen_ka", 5: "Obmen_ka_5", 7: "Obmen"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got labels %v, want %v", got, want)
+	}
+	if !strings.Contains(logs.String(), "exchanger label collides") || !strings.Contains(logs.String(), "exchangerId=5") {
+		t.Errorf("got logs %q, want the collision of exchanger 5 logged", logs.String())
+	}
+}
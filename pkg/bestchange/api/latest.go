@@ -0,0 +1,100 @@
+package api
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slvic/stock-observer/pkg/bestchange/models"
+)
+
+// CodeRate is the best rate of the latest scrape between two currency codes,
+// in target currency per source currency
+type CodeRate struct {
+	Source    string    `json:"source"`
+	Target    string    `json:"target"`
+	Rate      float64   `json:"rate"`
+	Exchanger string    `json:"exchanger"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// latestRates keeps the code rates of the latest successful scrape
+type latestRates struct {
+	mu    sync.RWMutex
+	rates map[[2]string]CodeRate
+}
+
+func newLatestRates() *latestRates {
+	return &latestRates{rates: make(map[[2]string]CodeRate)}
+}
+
+// codePattern matches a code in parens or a trailing upper case word,
+// e.g. "Tether TRC20 (USDT)" or "Sberbank RUB"
+var codePattern = regexp.MustCompile(`(?:\(([A-Z0-9]{2,6})\)|\s([A-Z]{3,5}))$`)
+
+// currencyCode returns the code a bestchange currency name ends with,
+// ok is false for names without one
+func currencyCode(name string) (code string, ok bool) {
+	match := codePattern.FindStringSubmatch(strings.TrimSpace(name))
+	if match == nil {
+		return "", false
+	}
+	if match[1] != "" {
+		return match[1], true
+	}
+	return match[2], true
+}
+
+// codeRates collects the best code rates while the rates of a scrape stream by
+type codeRates map[[2]string]CodeRate
+
+// add takes a valid rate into account
+func (r codeRates) add(rate models.ExchangeRate, exchangerLabel string, scrapedAt time.Time) {
+	source, ok := currencyCode(rate.SourceCurrency)
+	if !ok {
+		return
+	}
+	target, ok := currencyCode(rate.TargetCurrency)
+	if !ok || source == target || rate.GiveRate <= 0 {
+		return
+	}
+	key := [2]string{source, target}
+	value := rate.GetRate / rate.GiveRate
+	if best, seen := r[key]; !seen || value > best.Rate {
+		r[key] = CodeRate{Source: source, Target: target, Rate: value, Exchanger: exchangerLabel, UpdatedAt: scrapedAt}
+	}
+}
+
+func (l *latestRates) replace(rates codeRates) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rates = rates
+}
+
+// LatestRates returns the best code rates of the latest successful scrape
+// ordered by source and target, empty before the first one
+func (b Bestchange) LatestRates() []CodeRate {
+	b.latest.mu.RLock()
+	rates := make([]CodeRate, 0, len(b.latest.rates))
+	for _, rate := range b.latest.rates {
+		rates = append(rates, rate)
+	}
+	b.latest.mu.RUnlock()
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Source != rates[j].Source {
+			return rates[i].Source < rates[j].Source
+		}
+		return rates[i].Target < rates[j].Target
+	})
+	return rates
+}
+
+// LatestRate returns the best rate of the latest scrape from source to target code
+func (b Bestchange) LatestRate(source, target string) (CodeRate, bool) {
+	b.latest.mu.RLock()
+	defer b.latest.mu.RUnlock()
+	rate, ok := b.latest.rates[[2]string{source, target}]
+	return rate, ok
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/pkg/bestchange/models"
+)
+
+func TestCurrencyCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+		wantOk   bool
+	}{
+		{name: "code in parens", currency: "Tether TRC20 (USDT)", want: "USDT", wantOk: true},
+		{name: "trailing code", currency: "Sberbank RUB", want: "RUB", wantOk: true},
+		{name: "trailing spaces", currency: "Bitcoin (BTC) ", want: "BTC", wantOk: true},
+		{name: "no code", currency: "Qiwi"},
+		{name: "lower case word", currency: "Visa card rub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := currencyCode(tt.currency)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCodeRates(t *testing.T) {
+	scrapedAt := time.Now()
+	rates := make(codeRates)
+	rates.add(models.ExchangeRate{SourceCurrency: "Sberbank RUB", TargetCurrency: "Tether TRC20 (USDT)", GiveRate: 95, GetRate: 1}, "slow", scrapedAt)
+	rates.add(models.ExchangeRate{SourceCurrency: "Tinkoff RUB", TargetCurrency: "Tether ERC20 (USDT)", GiveRate: 90, GetRate: 1}, "fast", scrapedAt)
+	rates.add(models.ExchangeRate{SourceCurrency: "Qiwi", TargetCurrency: "Tether TRC20 (USDT)", GiveRate: 1, GetRate: 1}, "unknown", scrapedAt)
+
+	b := Bestchange{latest: newLatestRates()}
+	b.latest.replace(rates)
+	rate, ok := b.LatestRate("RUB", "USDT")
+	if !ok {
+		t.Fatalf("got no RUB to USDT rate")
+	}
+	if rate.Exchanger != "fast" || rate.Rate != 1.0/90 {
+		t.Errorf("got rate %v of %s, want %v of fast", rate.Rate, rate.Exchanger, 1.0/90)
+	}
+	if got := len(b.LatestRates()); got != 1 {
+		t.Errorf("got %d code rates, want 1", got)
+	}
+}
@@ -24,6 +24,7 @@ type RawExchangeRate struct {
 type ExchangeRate struct {
 	SourceCurrency        string
 	TargetCurrency        string
+	ExchangerId           int
 	ExchangerName         string
 	GiveRate              float64
 	GetRate               float64
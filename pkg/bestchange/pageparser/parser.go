@@ -3,7 +3,7 @@ package pageparser
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -62,7 +62,7 @@ func (b BestchangePageParser) GetAssets() ([]models.ExchangePair, error) {
 		}
 		exchangePair, err := ParseBestchangeAssetsRow(RenderNode(linkElement))
 		if err != nil {
-			log.Printf("could not parse bestchange assets row %s \n\r error: %s", RenderNode(linkElement), err.Error())
+			slog.Warn("could not parse an assets row", "source", "bestchange", "row", RenderNode(linkElement), "err", err)
 			continue
 		}
 		exchangePairs = append(exchangePairs, exchangePair)
@@ -75,11 +75,11 @@ func (b BestchangePageParser) GetExchangers(exchanges []models.ExchangePair) err
 	for _, exchange := range exchanges {
 		err := b.getExchangersByPair(exchange)
 		if err != nil {
-			log.Printf(
-				"could not get exchange by pair give: %s, get: %s \n\n Error: %s",
-				exchange.Give,
-				exchange.Get,
-				err.Error(),
+			slog.Error("could not get exchangers by pair",
+				"source", "bestchange",
+				"give", exchange.Give,
+				"get", exchange.Get,
+				"err", err,
 			)
 			continue
 		}
@@ -112,7 +112,7 @@ func (b BestchangePageParser) getExchangersByPair(exchange models.ExchangePair)
 	for _, tableRowNode := range exchangersTableRowNodes {
 		row, err := ParseBestchangeExchangerRow(RenderNode(tableRowNode))
 		if err != nil {
-			log.Printf("could not parse bestchange exchanger row %s \n\r error: %s", RenderNode(tableRowNode), err.Error())
+			slog.Warn("could not parse an exchanger row", "source", "bestchange", "row", RenderNode(tableRowNode), "err", err)
 			continue
 		}
 		bestchangeTable = append(bestchangeTable, row)
@@ -2,193 +2,1063 @@ package binance
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/archive"
 	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/latency"
+	"github.com/slvic/stock-observer/internal/relabel"
+	"github.com/slvic/stock-observer/internal/storage"
+	"github.com/slvic/stock-observer/internal/summary"
 	"github.com/slvic/stock-observer/pkg/markets/models"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 func init() {
 	prometheus.MustRegister(binancePrice)
 	prometheus.MustRegister(binanceTradableQuantity)
 	prometheus.MustRegister(binanceCommissionRate)
+	prometheus.MustRegister(binanceMinTransAmount)
+	prometheus.MustRegister(binanceMaxTransAmount)
+	prometheus.MustRegister(binanceAdvertiserMonthOrderCount)
+	prometheus.MustRegister(binanceAdvertiserMonthFinishRate)
+	prometheus.MustRegister(binancePriceBandRejected)
+	prometheus.MustRegister(binanceLowLiquidity)
 }
 
 var (
 	binancePriceSummaryOpts = prometheus.SummaryOpts{
 		Namespace: "binance",
 		Name:      "price",
+		Help:      "Offer prices, in fiat per asset unit.",
 	}
 	binanceTradableQuantitySummaryOpts = prometheus.SummaryOpts{
 		Namespace: "binance",
 		Name:      "tradableQuantity",
+		Help:      "Tradable quantity of the offers, in asset units.",
 	}
 	binanceCommissionRateSummaryOpts = prometheus.SummaryOpts{
 		Namespace: "binance",
 		Name:      "commissionRate",
+		Help:      "Commission rate of the offers, as a fraction.",
 	}
-	binanceLabels = []string{"tradeType", "asset", "fiat"}
+	binanceMinTransAmountSummaryOpts = prometheus.SummaryOpts{
+		Namespace: "binance",
+		Name:      "minTransAmount",
+		Help:      "Minimum single transaction amount of the offers, in fiat.",
+	}
+	binanceMaxTransAmountSummaryOpts = prometheus.SummaryOpts{
+		Namespace: "binance",
+		Name:      "maxTransAmount",
+		Help:      "Maximum single transaction amount of the offers, in fiat.",
+	}
+	binanceLabels = []string{"tradeType", "asset", "fiat", "currencyGroup", "merchant", "payType"}
+	// labels of the metrics derived from both sides of a pair
+	pairLabels = []string{"asset", "fiat", "merchant", "payType"}
 )
 
+// withLabels extends binanceLabels with metric specific labels
+func withLabels(names ...string) []string {
+	return append(append([]string(nil), binanceLabels...), names...)
+}
+
 var (
-	binancePrice = prometheus.NewSummaryVec(
+	// offer observers are summaries unless histograms are configured
+	binancePrice prometheus.ObserverVec = prometheus.NewSummaryVec(
 		binancePriceSummaryOpts,
 		binanceLabels,
 	)
-	binanceTradableQuantity = prometheus.NewSummaryVec(
+	binanceTradableQuantity prometheus.ObserverVec = prometheus.NewSummaryVec(
 		binanceTradableQuantitySummaryOpts,
 		binanceLabels,
 	)
-	binanceCommissionRate = prometheus.NewSummaryVec(
+	binanceCommissionRate prometheus.ObserverVec = prometheus.NewSummaryVec(
 		binanceCommissionRateSummaryOpts,
 		binanceLabels,
 	)
+	binanceMinTransAmount = prometheus.NewSummaryVec(
+		binanceMinTransAmountSummaryOpts,
+		binanceLabels,
+	)
+	binanceMaxTransAmount = prometheus.NewSummaryVec(
+		binanceMaxTransAmountSummaryOpts,
+		binanceLabels,
+	)
+	binanceAdvertiserMonthOrderCount = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace: "binance",
+			Name:      "advertiserMonthOrderCount",
+			Help:      "Orders of the advertisers of the offers in the last 30 days.",
+		},
+		binanceLabels,
+	)
+	binanceAdvertiserMonthFinishRate = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace: "binance",
+			Name:      "advertiserMonthFinishRate",
+			Help:      "Completion rate of the orders of the advertisers of the offers in the last 30 days, as a fraction.",
+		},
+		binanceLabels,
+	)
+	binancePriceBandRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binance",
+			Name:      "price_band_rejected_total",
+			Help:      "Offers dropped for being priced outside of the configured band.",
+		},
+		binanceLabels,
+	)
+	binanceLowLiquidity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "low_liquidity",
+			Help:      "1 when fewer offers than minOffersToPublish were returned, 0 otherwise.",
+		},
+		binanceLabels,
+	)
+)
+
+const (
+	// successCode is the code of a successful binance response
+	successCode            = "000000"
+	defaultRequestIdHeader = "X-Request-Id"
+	defaultRows            = 20
+	defaultMaxPages        = 1
+	// requests in flight at once
+	defaultMaxConcurrency = 8
+	// a scrape with more failed requests than this is reported as failed
+	defaultMaxFailedPercent = 50
+	defaultCurrencyGroup    = "other"
+	defaultTimeout          = 15 * time.Second
+	// retries of a response with one of the retryErrorCodes in its body
+	defaultErrorCodeRetries = 2
+	// after this many consecutive empty cycles a market is treated as genuinely empty
+	alwaysEmptyCycles = 3
 )
 
 type Binance struct {
-	config     configs.Binance
-	httpClient http.Client
+	config      configs.Binance
+	endpoints   []endpoint
+	clients     map[string]*pairClient
+	latency     *latency.Tracker
+	circuits    *pairCircuits
+	processors  offerProcessors
+	percentiles []percentileGauge
+	samples     *archive.Writer
+	relabel     relabel.Rules
+	standby     *standby
+	discovery   *discovery
+	rows        *rowsController
+	clock       serverClock
+
+	emptyMu      sync.Mutex
+	emptyStreaks map[string]int
+
+	correlationMu sync.Mutex
+	correlations  map[string]*rollingCorrelation
+
+	zScoreMu sync.Mutex
+	zScores  map[string]*rollingStats
+
+	snapshots *snapshots
+
+	// reloaded is the watchlist of a reload waiting for the next scrape
+	reloadMu sync.Mutex
+	reloaded *watchlist
+	// limiter is nil without a rate limit
+	limiter *rate.Limiter
+
+	store   *storage.Store
+	stored  []models.OfferSample
+	storeMu sync.Mutex
+
+	logger *slog.Logger
 }
 
-func New(cfg configs.Binance) *Binance {
+func New(cfg configs.Binance, processors ...OfferProcessor) (*Binance, error) {
+	if cfg.RequestIdHeader == "" {
+		cfg.RequestIdHeader = defaultRequestIdHeader
+	}
+	if cfg.Rows == 0 {
+		cfg.Rows = defaultRows
+	}
+	if cfg.DefaultCurrencyGroup == "" {
+		cfg.DefaultCurrencyGroup = defaultCurrencyGroup
+	}
+	if cfg.ExcludeTwoSided {
+		cfg.DetectTwoSided = true
+	}
+	if cfg.MaxFailedPercent == 0 {
+		cfg.MaxFailedPercent = defaultMaxFailedPercent
+	}
+	if cfg.MaxConcurrency == 0 {
+		cfg.MaxConcurrency = defaultMaxConcurrency
+	}
+	if cfg.MaxPages == 0 {
+		cfg.MaxPages = defaultMaxPages
+	}
+	if cfg.PageConcurrency == 0 {
+		cfg.PageConcurrency = 1
+	}
+	cfg.PageConcurrency = min(cfg.PageConcurrency, cfg.MaxPages, cfg.MaxConcurrency)
+	if cfg.BestN == 0 {
+		cfg.BestN = defaultBestN
+	}
+	if len(cfg.RetryErrorCodes) != 0 && cfg.ErrorCodeRetries == 0 {
+		cfg.ErrorCodeRetries = defaultErrorCodeRetries
+	}
+	if cfg.BaseDelayInMilliseconds == 0 {
+		cfg.BaseDelayInMilliseconds = defaultBaseDelay.Milliseconds()
+	}
+	if cfg.MaxDelayInMilliseconds == 0 {
+		cfg.MaxDelayInMilliseconds = defaultMaxDelay.Milliseconds()
+	}
+	if cfg.ZScoreWindow == 0 {
+		cfg.ZScoreWindow = defaultZScoreWindow
+	}
+	if cfg.ZScoreThreshold == 0 {
+		cfg.ZScoreThreshold = defaultZScoreThreshold
+	}
+	if cfg.CorrelationWindow == 0 {
+		cfg.CorrelationWindow = defaultCorrelationWindow
+	}
+	percentiles, err := newPercentileGauges(cfg.Percentiles)
+	if err != nil {
+		return nil, fmt.Errorf("could not create percentile gauges: %w", err)
+	}
+	relabelRules, err := relabel.New(binanceLabels, cfg.Relabels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relabel rules: %w", err)
+	}
+	clients, err := newPairClients(cfg.Clients, cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clients: %w", err)
+	}
+	for _, pair := range cfg.Pairs {
+		if _, ok := clients[pair.Client]; !ok {
+			return nil, fmt.Errorf("pair %s/%s references unknown client %s", pair.Asset, pair.Fiat, pair.Client)
+		}
+	}
+	if cfg.Histograms != nil {
+		if err := useHistograms(*cfg.Histograms); err != nil {
+			return nil, fmt.Errorf("could not switch to histograms: %w", err)
+		}
+	}
+	discovery, err := newDiscovery(cfg.Discovery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery: %w", err)
+	}
+	samples, err := archive.NewWriter(cfg.Samples)
+	if err != nil {
+		return nil, fmt.Errorf("could not create samples writer: %w", err)
+	}
 	return &Binance{
-		config:     cfg,
-		httpClient: http.Client{Timeout: 15 * time.Second},
+		config:       cfg,
+		endpoints:    endpoints(cfg),
+		clients:      clients,
+		latency:      latency.NewTracker("binance", cfg.AdaptiveTimeout, defaultTimeout),
+		circuits:     newPairCircuits(cfg.PairCircuit),
+		processors:   processors,
+		emptyStreaks: make(map[string]int),
+		correlations: make(map[string]*rollingCorrelation),
+		zScores:      make(map[string]*rollingStats),
+		percentiles:  percentiles,
+		samples:      samples,
+		relabel:      relabelRules,
+		standby:      newStandby(cfg.StaleOnFailure),
+		discovery:    discovery,
+		rows:         newRowsController(cfg.AdaptiveRows, cfg.Rows),
+		snapshots:    newSnapshots(),
+		limiter:      newLimiter(cfg.RequestsPerSecond, cfg.Burst),
+		logger:       slog.Default().With("source", "binance"),
+	}, nil
+}
+
+// UseLogger replaces the default logger, the source attribute is added to it
+func (b *Binance) UseLogger(logger *slog.Logger) {
+	b.logger = logger.With("source", b.Name())
+}
+
+// scheduledPairs lists every configured asset/fiat pair, pairs with a higher
+// priority come first and equal priorities keep the configured order
+func (b *Binance) scheduledPairs() []configs.Pair {
+	priorities := make(map[string]int, len(b.config.Pairs))
+	for _, pair := range b.config.Pairs {
+		priorities[pairKey(pair.Asset, pair.Fiat)] = pair.Priority
 	}
+
+	pairs := make([]configs.Pair, 0, len(b.config.Fiats)*len(b.config.Assets))
+	for _, fiat := range b.config.Fiats {
+		for _, asset := range b.assetsFor(fiat) {
+			pairs = append(pairs, configs.Pair{
+				Asset:    asset,
+				Fiat:     fiat,
+				Priority: priorities[pairKey(asset, fiat)],
+			})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Priority > pairs[j].Priority
+	})
+	return pairs
+}
+
+func (b *Binance) currencyGroup(fiat string) string {
+	if group, ok := b.config.CurrencyGroups[fiat]; ok {
+		return group
+	}
+	return b.config.DefaultCurrencyGroup
+}
+
+// rowsFor returns the per-pair rows override or the global default
+func (b *Binance) rowsFor(asset, fiat string) int32 {
+	for _, pair := range b.config.Pairs {
+		if pair.Asset == asset && pair.Fiat == fiat && pair.Rows != 0 {
+			return pair.Rows
+		}
+	}
+	if b.rows != nil {
+		return b.rows.current()
+	}
+	return b.config.Rows
+}
+
+// payTypeFilters lists the payTypes filters every pair is requested with,
+// with splitByPayType every pay type is requested on its own
+func (b *Binance) payTypeFilters() [][]string {
+	if !b.config.SplitByPayType || len(b.config.PayTypes) == 0 {
+		return [][]string{b.config.PayTypes}
+	}
+	filters := make([][]string, 0, len(b.config.PayTypes))
+	for _, payType := range b.config.PayTypes {
+		filters = append(filters, []string{payType})
+	}
+	return filters
 }
 
-func getOptions(asset, fiat string) []models.BinanceRequest {
+// merchantChecks lists the merchantCheck values every pair is requested with
+func (b *Binance) merchantChecks() []bool {
+	if b.config.MerchantBoth {
+		return []bool{true, false}
+	}
+	return []bool{b.config.MerchantOnly == nil || *b.config.MerchantOnly}
+}
+
+// optionGroups returns the options of the pair grouped by the sides of
+// a single request variant, every group has a BUY and a SELL side
+func (b *Binance) optionGroups(pair configs.Pair) [][]models.BinanceRequest {
+	rows := b.rowsFor(pair.Asset, pair.Fiat)
+	var groups [][]models.BinanceRequest
+	for _, merchantCheck := range b.merchantChecks() {
+		for _, payTypes := range b.payTypeFilters() {
+			groups = append(groups, getOptions(pair.Asset, pair.Fiat, rows, merchantCheck, payTypes))
+		}
+	}
+	return groups
+}
+
+func getOptions(asset, fiat string, rows int32, merchantCheck bool, payTypes []string) []models.BinanceRequest {
 	return []models.BinanceRequest{
 		{
 			Asset:         asset,
 			Fiat:          fiat,
-			MerchantCheck: true,
+			MerchantCheck: merchantCheck,
 			Page:          1,
+			PayTypes:      payTypes,
 			PublisherType: nil,
-			Rows:          20,
-			TradeType:     "BUY",
+			Rows:          rows,
+			TradeType:     buyTradeType,
 		},
 		{
 			Asset:         asset,
 			Fiat:          fiat,
-			MerchantCheck: true,
+			MerchantCheck: merchantCheck,
 			Page:          1,
+			PayTypes:      payTypes,
 			PublisherType: nil,
-			Rows:          20,
-			TradeType:     "SELL",
+			Rows:          rows,
+			TradeType:     sellTradeType,
 		},
 	}
 }
 
-func (b *Binance) GetAllData(ctx context.Context) {
-	log.Printf("binance data gathering started")
+func (b *Binance) Name() string {
+	return "binance"
+}
+
+func (b *Binance) Collect(ctx context.Context) error {
+	return b.GetAllData(ctx)
+}
+
+// GetAllData scrapes every pair once, an error is returned when more than
+// maxFailedPercent of the requests failed
+func (b *Binance) GetAllData(ctx context.Context) error {
+	b.applyReload()
+	b.logger.Info("data gathering started")
+	b.setTimeouts(b.latency.Timeout())
 
-	binanceRequest, ctx := errgroup.WithContext(ctx)
-	for _, fiat := range b.config.Fiats {
-		for _, asset := range b.config.Assets {
-			options := getOptions(asset, fiat)
+	cycle := summary.NewCycle("binance", errorKinds...)
+	defer cycle.Report()
+
+	startTime := time.Now()
+	defer func() {
+		summary.ObservePhase("binance", summary.TotalPhase, startTime)
+		b.rows.observe(time.Since(startTime))
+	}()
+
+	// the offers gathered so far are stored even when the scrape is abandoned
+	defer b.storeOffers(ctx)
+
+	b.syncClock(ctx)
+	b.discover(ctx)
+	round := b.circuits.newRound()
+	binanceRequest, requestCtx := errgroup.WithContext(ctx)
+	binanceRequest.SetLimit(max(1, b.config.MaxConcurrency/b.config.PageConcurrency))
+	for _, pair := range b.scheduledPairs() {
+		if !b.circuits.allow(pair.Asset, pair.Fiat) {
+			continue
+		}
+		for _, options := range b.optionGroups(pair) {
+			if b.pairLevel() {
+				binanceRequest.Go(queued(b.pairRequest(requestCtx, cycle, round, options)))
+				continue
+			}
 			for _, option := range options {
-				binanceRequest.Go(func() error {
-					err := b.getData(&option)
-					if err != nil {
-						log.Printf("could not get binance data: %s", err.Error())
-					}
-					return nil
-				})
+				binanceRequest.Go(queued(b.sideRequest(requestCtx, cycle, round, option)))
 			}
+		}
+	}
+	_ = binanceRequest.Wait()
+	round.close()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("binance scrape is abandoned: %w", err)
+	}
+	if err := cycle.Err(b.config.MaxFailedPercent); err != nil {
+		return fmt.Errorf("binance scrape failed: %w", err)
+	}
+	summary.MarkSuccess("binance")
+	if failed := cycle.Failed(); failed != 0 {
+		b.logger.Warn("data is gathered with failed requests", "failed", failed)
+		return nil
+	}
+	b.logger.Info("data is gathered")
+	return nil
+}
+
+// pairRequest collects both sides of a pair, the options are a parameter
+// so that every request keeps the options of its own loop iteration
+func (b *Binance) pairRequest(ctx context.Context, cycle *summary.Cycle, round *pairRound, options []models.BinanceRequest) func() error {
+	return func() error {
+		b.getPairData(ctx, cycle, round, options)
+		return nil
+	}
+}
+
+// sideRequest collects and observes a single side, like pairRequest
+// it gets its own copy of the options
+func (b *Binance) sideRequest(ctx context.Context, cycle *summary.Cycle, round *pairRound, option models.BinanceRequest) func() error {
+	return func() error {
+		result, err := b.collect(ctx, &option)
+		b.record(ctx, cycle, round, &option, err)
+		if err == nil {
+			b.observe(ctx, result)
+		}
+		return nil
+	}
+}
 
+// pairLevel reports whether both sides of a pair have to be collected together
+func (b *Binance) pairLevel() bool {
+	return b.config.CompletePairsOnly || b.config.DetectTwoSided ||
+		b.config.MidPrice || b.config.Spread
+}
+
+// getPairData collects both sides of a pair, with completePairsOnly they are
+// observed only when every side was collected, otherwise the pair is skipped this cycle
+func (b *Binance) getPairData(ctx context.Context, cycle *summary.Cycle, round *pairRound, options []models.BinanceRequest) {
+	results := make([]*sideResult, 0, len(options))
+	complete := true
+	for i := range options {
+		result, err := b.collect(ctx, &options[i])
+		b.record(ctx, cycle, round, &options[i], err)
+		if err != nil {
+			complete = false
+			continue
 		}
+		results = append(results, result)
 	}
-	if err := binanceRequest.Wait(); err != nil {
-		log.Printf("binance api data gathered with errors: %s", err.Error())
+	if !complete && b.config.CompletePairsOnly {
+		b.logger.Info("pair is incomplete, its observations are discarded",
+			"asset", options[0].Asset, "fiat", options[0].Fiat)
 		return
 	}
-	log.Printf("binance api data is successfully gathered: %v", time.Now())
+	if complete && b.config.DetectTwoSided {
+		b.observeTwoSided(&options[0], results)
+	}
+	if complete {
+		b.observePairPrices(&options[0], results)
+	}
+	for _, result := range results {
+		b.observe(ctx, result)
+	}
 }
 
-func (b *Binance) getData(options *models.BinanceRequest) error {
-	var binanceResponse models.BinanceResponse
-
-	response, err := b.sendRequest(options)
+// record counts the result of a request and adds it to the round of the pair
+// circuits, a request failing because the scrape is shutting down or ran out
+// of time is not a failure of the pair and is neither counted nor added
+func (b *Binance) record(ctx context.Context, cycle *summary.Cycle, round *pairRound, options *models.BinanceRequest, err error) {
+	if err != nil && ctx.Err() != nil {
+		b.logger.Info("request is abandoned with the scrape", "asset", options.Asset, "fiat", options.Fiat, "market", marketKey(options), "err", ctx.Err())
+		return
+	}
 	if err != nil {
-		return fmt.Errorf("could not send request: %s", err.Error())
+		b.logger.Error("could not get data", "asset", options.Asset, "fiat", options.Fiat, "market", marketKey(options), "err", err)
+		kind := requestErrorKind
+		var fetchErr *fetchError
+		if errors.As(err, &fetchErr) {
+			kind = fetchErr.kind
+		}
+		cycle.Failure(kind, marketKey(options))
+		round.add(options.Asset, options.Fiat, true)
+		b.standby.reemit(options)
+		return
+	}
+	cycle.Success()
+	round.add(options.Asset, options.Fiat, false)
+}
+
+// sideResult is a parsed side of a pair waiting to be observed
+type sideResult struct {
+	options  *models.BinanceRequest
+	labels   []string
+	dropped  bool
+	adsCount int
+	rejected int
+	offers   []models.Offer
+	// when the last page of the side was received
+	scrapedAt time.Time
+}
+
+// collect fetches and parses a side of a pair without observing anything
+func (b *Binance) collect(ctx context.Context, options *models.BinanceRequest) (*sideResult, error) {
+	labels, keep := b.labelsFor(options)
+	if !keep {
+		return &sideResult{options: options, dropped: true}, nil
 	}
 
-	err = json.Unmarshal(response, &binanceResponse)
+	ads, err := b.getPages(ctx, options)
 	if err != nil {
-		return fmt.Errorf("could not unmarshal responce body: %s", err.Error())
+		return nil, err
 	}
 
-	for _, data := range binanceResponse.Data {
-		{ //price
-			price, err := strconv.ParseFloat(*data.Adv.Price, 64)
-			if err != nil {
-				return fmt.Errorf("could not parse the price")
+	result := &sideResult{
+		options:   options,
+		labels:    labels,
+		adsCount:  len(ads),
+		offers:    make([]models.Offer, 0, len(ads)),
+		scrapedAt: time.Now(),
+	}
+	for _, data := range ads {
+		offer, err := parseOffer(data)
+		if err != nil {
+			b.logger.Warn("skipping an ad", "asset", options.Asset, "fiat", options.Fiat, "market", marketKey(options), "err", err)
+			continue
+		}
+		if !b.inPriceBand(offer.Asset, offer.Fiat, offer.Price) {
+			result.rejected++
+			continue
+		}
+		result.offers = append(result.offers, offer)
+	}
+
+	return result, nil
+}
+
+// parseOffer parses the numeric fields of an ad,
+// an ad missing a required field is an error
+func parseOffer(data models.Data) (models.Offer, error) {
+	required := []struct {
+		name  string
+		value *string
+	}{
+		{"tradeType", data.Adv.TradeType},
+		{"asset", data.Adv.Asset},
+		{"fiatUnit", data.Adv.FiatUnit},
+		{"price", data.Adv.Price},
+		{"tradableQuantity", data.Adv.TradableQuantity},
+		{"commissionRate", data.Adv.CommissionRate},
+	}
+	for _, field := range required {
+		if field.value == nil {
+			return models.Offer{}, fmt.Errorf("the %s is missing", field.name)
+		}
+	}
+
+	offer := models.Offer{
+		TradeType: *data.Adv.TradeType,
+		Asset:     *data.Adv.Asset,
+		Fiat:      *data.Adv.FiatUnit,
+	}
+	fields := []struct {
+		name  string
+		raw   *string
+		value *float64
+	}{
+		{"price", data.Adv.Price, &offer.Price},
+		{"tradableQuantity", data.Adv.TradableQuantity, &offer.TradableQuantity},
+		{"commissionRate", data.Adv.CommissionRate, &offer.CommissionRate},
+	}
+	for _, field := range fields {
+		value, err := strconv.ParseFloat(*field.raw, 64)
+		if err != nil {
+			return models.Offer{}, fmt.Errorf("could not parse the %s %q: %w", field.name, *field.raw, err)
+		}
+		*field.value = value
+	}
+	limits := []struct {
+		name  string
+		raw   *string
+		value **float64
+	}{
+		{"minSingleTransAmount", data.Adv.MinSingleTransAmount, &offer.MinTransAmount},
+		{"maxSingleTransAmount", data.Adv.MaxSingleTransAmount, &offer.MaxTransAmount},
+	}
+	for _, limit := range limits {
+		if limit.raw == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(*limit.raw, 64)
+		if err != nil {
+			return models.Offer{}, fmt.Errorf("could not parse the %s %q: %w", limit.name, *limit.raw, err)
+		}
+		*limit.value = &value
+	}
+	for _, tradeMethod := range data.Adv.TradeMethods {
+		if tradeMethod.Identifier != nil {
+			offer.PayMethods = append(offer.PayMethods, *tradeMethod.Identifier)
+		}
+	}
+	if data.Advertiser.UserNo != nil {
+		offer.AdvertiserNo = *data.Advertiser.UserNo
+	}
+	offer.MonthOrderCount = data.Advertiser.MonthOrderCount
+	offer.MonthFinishRate = data.Advertiser.MonthFinishRate
+	return offer, nil
+}
+
+func (b *Binance) observe(ctx context.Context, result *sideResult) {
+	if result.dropped {
+		return
+	}
+	labels := result.labels
+
+	publishPrice := result.adsCount >= b.config.MinOffersToPublish
+	lowLiquidity := 0.0
+	if !publishPrice {
+		lowLiquidity = 1
+	}
+	binanceLowLiquidity.WithLabelValues(labels...).Set(lowLiquidity)
+	binancePriceBandRejected.WithLabelValues(labels...).Add(float64(result.rejected))
+
+	for _, offer := range result.offers {
+		if publishPrice {
+			binancePrice.WithLabelValues(labels...).Observe(offer.Price)
+		}
+		binanceTradableQuantity.WithLabelValues(labels...).Observe(offer.TradableQuantity)
+		binanceCommissionRate.WithLabelValues(labels...).Observe(offer.CommissionRate)
+		if offer.MinTransAmount != nil {
+			binanceMinTransAmount.WithLabelValues(labels...).Observe(*offer.MinTransAmount)
+		}
+		if offer.MaxTransAmount != nil {
+			binanceMaxTransAmount.WithLabelValues(labels...).Observe(*offer.MaxTransAmount)
+		}
+		if offer.MonthOrderCount != nil {
+			binanceAdvertiserMonthOrderCount.WithLabelValues(labels...).Observe(float64(*offer.MonthOrderCount))
+		}
+		if offer.MonthFinishRate != nil {
+			binanceAdvertiserMonthFinishRate.WithLabelValues(labels...).Observe(*offer.MonthFinishRate)
+		}
+	}
+
+	b.processors.run(ctx, b.logger, result.offers)
+	b.writeSamples(result.offers)
+	b.batchOffers(ctx, result.offers)
+	if publishPrice {
+		b.standby.update(result.options, labels, result.offers)
+		b.snapshots.update(result.options, result.offers)
+		b.observeDerived(result.options, labels, result.offers)
+	}
+}
+
+func (b *Binance) writeSamples(offers []models.Offer) {
+	if b.samples == nil {
+		return
+	}
+	now := time.Now()
+	samples := make([]interface{}, 0, len(offers))
+	for _, offer := range offers {
+		samples = append(samples, models.OfferSample{Time: now, Offer: offer})
+	}
+	if err := b.samples.Write(samples...); err != nil {
+		b.logger.Error("could not write samples", "err", err)
+	}
+}
+
+func (b *Binance) inPriceBand(asset, fiat string, price float64) bool {
+	for _, band := range b.config.PriceBands {
+		if band.Asset != asset || band.Fiat != fiat {
+			continue
+		}
+		if band.MinPrice != 0 && price < band.MinPrice {
+			return false
+		}
+		if band.MaxPrice != 0 && price > band.MaxPrice {
+			return false
+		}
+	}
+	return true
+}
+
+// getResponse fetches a page of ads, retrying up to RetryOnEmpty times when
+// binance answers with no ads unless the market has been empty for a while
+func (b *Binance) getResponse(ctx context.Context, options *models.BinanceRequest) (models.BinanceResponse, error) {
+	key := marketKey(options)
+	retries := b.config.RetryOnEmpty
+	// an empty page after the first one is the end of the book
+	firstPage := options.Page <= 1
+	if b.isAlwaysEmpty(key) || !firstPage {
+		retries = 0
+	}
+
+	attempt, codeAttempts := 0, 0
+	for {
+		var binanceResponse models.BinanceResponse
+
+		response, err := b.sendRequest(ctx, options)
+		if err != nil {
+			return models.BinanceResponse{}, &fetchError{
+				kind: requestErrorKind,
+				err:  fmt.Errorf("could not send request: %w", err),
+			}
+		}
+
+		err = json.Unmarshal(response, &binanceResponse)
+		if err != nil {
+			return models.BinanceResponse{}, &fetchError{
+				kind: decodeErrorKind,
+				err:  fmt.Errorf("could not unmarshal responce body: %s", err.Error()),
 			}
-			binancePrice.WithLabelValues([]string{
-				*data.Adv.TradeType,
-				*data.Adv.Asset,
-				*data.Adv.FiatUnit,
-			}...).Observe(price)
-		}
-		{ //tradableQuantity
-			tradableQuantity, err := strconv.ParseFloat(*data.Adv.TradableQuantity, 64)
-			if err != nil {
-				return fmt.Errorf("could not parse the price")
+		}
+
+		if code, ok := b.retryableCode(binanceResponse); ok {
+			if codeAttempts >= b.config.ErrorCodeRetries {
+				return models.BinanceResponse{}, &fetchError{
+					kind: errorCodeErrorKind,
+					err:  fmt.Errorf("binance responded with error code %s", code),
+				}
+			}
+			delay := b.backoffDelay(codeAttempts, 0)
+			codeAttempts++
+			b.logger.Warn("error code returned, retrying", "asset", options.Asset, "fiat", options.Fiat, "market", key, "code", code, "delay", delay)
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return models.BinanceResponse{}, &fetchError{
+					kind: requestErrorKind,
+					err:  fmt.Errorf("could not retry error code %s: %w", code, ctx.Err()),
+				}
+			case <-timer.C:
 			}
-			binanceTradableQuantity.WithLabelValues([]string{
-				*data.Adv.TradeType,
-				*data.Adv.Asset,
-				*data.Adv.FiatUnit,
-			}...).Observe(tradableQuantity)
-		}
-		{ //commissionRate
-			commissionRate, err := strconv.ParseFloat(*data.Adv.CommissionRate, 64)
-			if err != nil {
-				return fmt.Errorf("could not parse the price")
+			continue
+		}
+		if err = responseError(binanceResponse); err != nil {
+			return models.BinanceResponse{}, &fetchError{kind: errorCodeErrorKind, err: err}
+		}
+
+		if len(binanceResponse.Data) != 0 || attempt >= retries {
+			if firstPage {
+				b.trackEmpty(key, len(binanceResponse.Data) == 0)
 			}
-			binanceCommissionRate.WithLabelValues([]string{
-				*data.Adv.TradeType,
-				*data.Adv.Asset,
-				*data.Adv.FiatUnit,
-			}...).Observe(commissionRate)
+			return binanceResponse, nil
 		}
+		attempt++
+		b.logger.Info("no ads returned, retrying", "asset", options.Asset, "fiat", options.Fiat, "market", key)
 	}
+}
 
-	return nil
+// retryableCode reports whether the response body carries one of the retryErrorCodes
+func (b *Binance) retryableCode(response models.BinanceResponse) (string, bool) {
+	if response.Code == nil {
+		return "", false
+	}
+	for _, code := range b.config.RetryErrorCodes {
+		if *response.Code == code {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// responseError is an error with the message of the response when binance
+// reports a failure by a code other than successCode or by success being false,
+// responses without these fields are taken as successful
+func responseError(response models.BinanceResponse) error {
+	failed := response.Success != nil && !*response.Success
+	code := ""
+	if response.Code != nil {
+		code = *response.Code
+		failed = failed || code != successCode
+	}
+	if !failed {
+		return nil
+	}
+	var message []string
+	for _, part := range []*string{response.Message, response.MessageDetail} {
+		if part != nil && *part != "" {
+			message = append(message, *part)
+		}
+	}
+	if len(message) == 0 {
+		return fmt.Errorf("binance responded with error code %q", code)
+	}
+	return fmt.Errorf("binance responded with error code %q: %s", code, strings.Join(message, ": "))
+}
+
+// getPages walks the pages of the options until an empty or short page
+// or maxPages, an error after the first page keeps the pages gathered so far
+func (b *Binance) getPages(ctx context.Context, options *models.BinanceRequest) ([]models.Data, error) {
+	var (
+		ads  []models.Data
+		seen = make(map[string]bool)
+	)
+	for first := int32(1); first <= int32(b.config.MaxPages); first += int32(b.config.PageConcurrency) {
+		last := min(first+int32(b.config.PageConcurrency)-1, int32(b.config.MaxPages))
+		responses, errs := b.getPageRange(ctx, options, first, last)
+		for i := range responses {
+			page := first + int32(i)
+			if errs[i] != nil {
+				if page == 1 {
+					return nil, errs[i]
+				}
+				b.logger.Warn("could not get a page, using the gathered ads",
+					"asset", options.Asset, "fiat", options.Fiat, "market", marketKey(options),
+					"page", page, "ads", len(ads), "err", errs[i])
+				return ads, nil
+			}
+			// ads move between pages fetched at different times, an ad is kept
+			// on the first page it is seen on
+			for _, ad := range responses[i].Data {
+				if ad.Adv.AdvNo != nil {
+					if seen[*ad.Adv.AdvNo] {
+						continue
+					}
+					seen[*ad.Adv.AdvNo] = true
+				}
+				ads = append(ads, ad)
+			}
+			if int32(len(responses[i].Data)) < options.Rows {
+				return ads, nil
+			}
+		}
+	}
+	return ads, nil
+}
+
+// getPageRange requests the pages from first to last at once, the responses
+// and errors are in page order
+func (b *Binance) getPageRange(ctx context.Context, options *models.BinanceRequest, first, last int32) ([]models.BinanceResponse, []error) {
+	responses := make([]models.BinanceResponse, last-first+1)
+	errs := make([]error, len(responses))
+	var wg sync.WaitGroup
+	for i := range responses {
+		pageOptions := *options
+		pageOptions.Page = first + int32(i)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = b.getResponse(ctx, &pageOptions)
+		}(i)
+	}
+	wg.Wait()
+	return responses, errs
+}
+
+func marketKey(options *models.BinanceRequest) string {
+	key := fmt.Sprintf("%s %s/%s", options.TradeType, options.Asset, options.Fiat)
+	if !options.MerchantCheck {
+		key += " (all advertisers)"
+	}
+	if len(options.PayTypes) != 0 {
+		key += " [" + payTypeLabel(options) + "]"
+	}
+	return key
+}
+
+// payTypeLabel is empty for requests not filtered by pay type
+func payTypeLabel(options *models.BinanceRequest) string {
+	return strings.Join(options.PayTypes, ",")
+}
+
+// labelsFor returns the relabeled binanceLabels values of the options,
+// keep is false when the relabel rules drop them; a new label is added here
+// and to binanceLabels
+func (b *Binance) labelsFor(options *models.BinanceRequest) (labels []string, keep bool) {
+	return b.relabel.Apply([]string{
+		options.TradeType,
+		options.Asset,
+		options.Fiat,
+		b.currencyGroup(options.Fiat),
+		strconv.FormatBool(options.MerchantCheck),
+		payTypeLabel(options),
+	})
 }
 
-func (b Binance) sendRequest(options *models.BinanceRequest) ([]byte, error) {
+// pairLabelsFor returns the relabeled pairLabels values of the options, the
+// rules see a pair with an empty tradeType and keep is false when they drop it
+func (b *Binance) pairLabelsFor(options *models.BinanceRequest) (labels []string, keep bool) {
+	pair := *options
+	pair.TradeType = ""
+	sideLabels, keep := b.labelsFor(&pair)
+	if !keep {
+		return nil, false
+	}
+	labels = make([]string, 0, len(pairLabels))
+	for _, name := range pairLabels {
+		for i, sideName := range binanceLabels {
+			if sideName == name {
+				labels = append(labels, sideLabels[i])
+			}
+		}
+	}
+	return labels, true
+}
+
+func (b *Binance) isAlwaysEmpty(key string) bool {
+	b.emptyMu.Lock()
+	defer b.emptyMu.Unlock()
+	return b.emptyStreaks[key] >= alwaysEmptyCycles
+}
+
+func (b *Binance) trackEmpty(key string, empty bool) {
+	b.emptyMu.Lock()
+	defer b.emptyMu.Unlock()
+	if empty {
+		b.emptyStreaks[key]++
+		return
+	}
+	delete(b.emptyStreaks, key)
+}
+
+// sendRequest posts the options to the primary address and then to each
+// fallback address in order until one of them answers successfully, the
+// retries and the fallbacks share a budget of maxRetries+1 attempts
+func (b *Binance) sendRequest(ctx context.Context, options *models.BinanceRequest) ([]byte, error) {
+	requestId := uuid.NewString()
+
 	bodyBytes, err := json.Marshal(&options)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal options: %s", err.Error())
 	}
-	bodyReader := bytes.NewReader(bodyBytes)
+	if b.config.GzipRequests {
+		bodyBytes, err = gzipBody(bodyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not compress a request body: %s", err.Error())
+		}
+	}
 
-	response, err := b.httpClient.Post(b.config.Address, "application/json", bodyReader)
+	client := b.clientFor(options.Asset, options.Fiat)
+	attempts := b.attemptBudget()
+	for i, endpoint := range b.endpoints {
+		address := endpoint.address
+		var responseBodyBytes []byte
+		responseBodyBytes, err = b.postWithRetry(ctx, client, endpoint, requestId, bodyBytes, &attempts, len(b.endpoints)-i-1)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			binanceEndpointRequests.WithLabelValues(address, endpointFailure).Inc()
+			if i+1 < len(b.endpoints) {
+				b.logger.Warn("request failed, trying a fallback", "requestId", requestId, "address", address, "err", err)
+			}
+			continue
+		}
+		binanceEndpointRequests.WithLabelValues(address, endpointSuccess).Inc()
+		b.logger.Debug("request succeeded", "requestId", requestId, "market", marketKey(options), "address", address)
+		return responseBodyBytes, nil
+	}
+	return nil, err
+}
+
+func (b *Binance) post(ctx context.Context, client *pairClient, endpoint endpoint, requestId string, body []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.address, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("could not send a request: %s", err.Error())
+		return nil, fmt.Errorf("could not create a request %s: %s", requestId, err.Error())
 	}
+	if endpoint.sign {
+		b.sign(request, body)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if b.config.GzipRequests {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	b.setHeaders(request, client)
+	request.Header.Set(b.config.RequestIdHeader, requestId)
+
+	if err = b.wait(ctx); err != nil {
+		return nil, fmt.Errorf("could not wait for the rate limiter %s: %w", requestId, err)
+	}
+	startTime := time.Now()
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not send a request %s: %w", requestId, err)
+	}
+	defer response.Body.Close()
 
 	responseBodyBytes, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, fmt.Errorf("could not read a responce body: %s", err.Error())
+		return nil, fmt.Errorf("could not read a responce body of request %s: %s", requestId, err.Error())
 	}
+	b.latency.Observe(time.Since(startTime))
 
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unsuccessfull request, status code %d, response body: %s",
-			response.StatusCode,
-			string(responseBodyBytes))
+		return nil, &statusError{
+			code:       response.StatusCode,
+			retryAfter: response.Header.Get("Retry-After"),
+			err: fmt.Errorf("unsuccessfull request %s, status code %d, response body: %s",
+				requestId,
+				response.StatusCode,
+				string(responseBodyBytes)),
+		}
 	}
 
 	return responseBodyBytes, nil
 }
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,467 @@
+package binance
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/storage"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestBinance returns a Binance sending every request to handler,
+// the address of cfg is set to the test server unless it is set already
+func newTestBinance(t *testing.T, cfg configs.Binance, handler http.HandlerFunc) *Binance {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	if cfg.Address == "" && len(cfg.Addresses) == 0 && len(cfg.Endpoints) == 0 {
+		cfg.Address = server.URL
+	}
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatalf("could not create binance: %s", err.Error())
+	}
+	b.UseLogger(discardLogger)
+	return b
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+// testAd is an ad with the required fields set
+func testAd(tradeType, asset, fiat, price string) models.Data {
+	return models.Data{
+		Adv: models.Adv{
+			TradeType:        stringPtr(tradeType),
+			Asset:            stringPtr(asset),
+			FiatUnit:         stringPtr(fiat),
+			Price:            stringPtr(price),
+			TradableQuantity: stringPtr("100"),
+			CommissionRate:   stringPtr("0.001"),
+		},
+	}
+}
+
+// writeAds answers with a successful response carrying the ads
+func writeAds(t *testing.T, w http.ResponseWriter, ads ...models.Data) {
+	t.Helper()
+	success := true
+	response := models.BinanceResponse{Code: stringPtr(successCode), Success: &success, Data: ads}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		t.Errorf("could not write a response: %s", err.Error())
+	}
+}
+
+// decodeRequest reads the options a request was sent with
+func decodeRequest(t *testing.T, r *http.Request) models.BinanceRequest {
+	t.Helper()
+	var options models.BinanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		t.Errorf("could not decode a request: %s", err.Error())
+	}
+	return options
+}
+
+// observations returns the number and the sum of observations of a summary or histogram series
+func observations(t *testing.T, vec prometheus.ObserverVec, labels ...string) (uint64, float64) {
+	t.Helper()
+	metric, ok := vec.WithLabelValues(labels...).(prometheus.Metric)
+	if !ok {
+		t.Fatalf("observer of %v is not a metric", labels)
+	}
+	var written dto.Metric
+	if err := metric.Write(&written); err != nil {
+		t.Fatalf("could not write a metric: %s", err.Error())
+	}
+	if written.Summary != nil {
+		return written.Summary.GetSampleCount(), written.Summary.GetSampleSum()
+	}
+	return written.Histogram.GetSampleCount(), written.Histogram.GetSampleSum()
+}
+
+func TestCollect(t *testing.T) {
+	tests := []struct {
+		name       string
+		asset      string
+		handler    func(t *testing.T, w http.ResponseWriter)
+		wantPrices []float64
+		wantStatus int
+	}{
+		{
+			name:  "multiple ads",
+			asset: "MULTI",
+			handler: func(t *testing.T, w http.ResponseWriter) {
+				writeAds(t, w,
+					testAd(buyTradeType, "MULTI", "RUB", "90.5"),
+					testAd(buyTradeType, "MULTI", "RUB", "91"),
+					testAd(buyTradeType, "MULTI", "RUB", "92.25"),
+				)
+			},
+			wantPrices: []float64{90.5, 91, 92.25},
+		},
+		{
+			name:  "empty response",
+			asset: "EMPTY",
+			handler: func(t *testing.T, w http.ResponseWriter) {
+				writeAds(t, w)
+			},
+		},
+		{
+			name:  "malformed price",
+			asset: "MALFORMED",
+			handler: func(t *testing.T, w http.ResponseWriter) {
+				writeAds(t, w, testAd(buyTradeType, "MALFORMED", "RUB", "ninety"))
+			},
+		},
+		{
+			name:  "non-200 status",
+			asset: "STATUS",
+			handler: func(t *testing.T, w http.ResponseWriter) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBinance(t, configs.Binance{}, func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(t, w)
+			})
+			options := getOptions(tt.asset, "RUB", defaultRows, true, nil)[0]
+			labels, _ := b.labelsFor(&options)
+
+			result, err := b.collect(context.Background(), &options)
+			if tt.wantStatus != 0 {
+				var statusErr *statusError
+				if !errors.As(err, &statusErr) || statusErr.code != tt.wantStatus {
+					t.Fatalf("got error %v, want status %d", err, tt.wantStatus)
+				}
+				var fetchErr *fetchError
+				if !errors.As(err, &fetchErr) || fetchErr.kind != requestErrorKind {
+					t.Errorf("got error %v, want a %s fetch error", err, requestErrorKind)
+				}
+				failures := testutil.ToFloat64(binanceEndpointRequests.WithLabelValues(b.endpoints[0].address, endpointFailure))
+				if failures != 1 {
+					t.Errorf("got %v endpoint failures, want 1", failures)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not collect: %s", err.Error())
+			}
+			if len(result.offers) != len(tt.wantPrices) {
+				t.Fatalf("got %d offers, want %d", len(result.offers), len(tt.wantPrices))
+			}
+			for i, offer := range result.offers {
+				if offer.Price != tt.wantPrices[i] {
+					t.Errorf("offer %d: got price %v, want %v", i, offer.Price, tt.wantPrices[i])
+				}
+			}
+
+			b.observe(context.Background(), result)
+			if count, _ := observations(t, binancePrice, labels...); count != uint64(len(tt.wantPrices)) {
+				t.Errorf("got %d price observations, want %d", count, len(tt.wantPrices))
+			}
+			if count, _ := observations(t, binanceTradableQuantity, labels...); count != uint64(len(tt.wantPrices)) {
+				t.Errorf("got %d tradable quantity observations, want %d", count, len(tt.wantPrices))
+			}
+		})
+	}
+}
+
+func TestGetAllDataRequestsEverySide(t *testing.T) {
+	prices := map[string]string{buyTradeType: "90", sellTradeType: "95"}
+	tests := []struct {
+		name string
+		cfg  configs.Binance
+	}{
+		{
+			name: "independent sides",
+			cfg:  configs.Binance{Assets: []string{"LOOPA", "LOOPB"}, Fiats: []string{"RUB", "KZT"}},
+		},
+		{
+			name: "pair level",
+			cfg:  configs.Binance{Assets: []string{"LOOPC", "LOOPD"}, Fiats: []string{"RUB", "KZT"}, MidPrice: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests = make(map[string]int)
+			)
+			b := newTestBinance(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				mu.Lock()
+				requests[marketKey(&options)]++
+				mu.Unlock()
+				writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, prices[options.TradeType]))
+			})
+			if err := b.GetAllData(context.Background()); err != nil {
+				t.Fatalf("could not get data: %s", err.Error())
+			}
+
+			for _, fiat := range tt.cfg.Fiats {
+				for _, asset := range tt.cfg.Assets {
+					for _, option := range getOptions(asset, fiat, defaultRows, true, nil) {
+						if got := requests[marketKey(&option)]; got != 1 {
+							t.Errorf("%s: got %d requests, want 1", marketKey(&option), got)
+						}
+						labels, _ := b.labelsFor(&option)
+						count, sum := observations(t, binancePrice, labels...)
+						if count != 1 || strconv.FormatFloat(sum, 'f', -1, 64) != prices[option.TradeType] {
+							t.Errorf("%s: got %d prices summing to %v, want the %s price %s",
+								marketKey(&option), count, sum, option.TradeType, prices[option.TradeType])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllDataScrapeTimeout(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "observer.db")
+	store, err := storage.Open(context.Background(), dsn, 0)
+	if err != nil {
+		t.Fatalf("could not open storage: %s", err.Error())
+	}
+	defer store.Close()
+
+	cfg := configs.Binance{
+		Assets:      []string{"FAST", "SLOW"},
+		Fiats:       []string{"RUB"},
+		PairCircuit: &configs.PairCircuit{FailureThreshold: 1, CooldownInSeconds: 3600},
+	}
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		options := decodeRequest(t, r)
+		if options.Asset == "SLOW" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	})
+	b.UseStorage(store)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	err = b.GetAllData(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Errorf("scrape took %s after the deadline", elapsed)
+	}
+	if !b.circuits.allow("SLOW", "RUB") {
+		t.Errorf("the circuit of the timed out pair is open")
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("could not open the database: %s", err.Error())
+	}
+	defer db.Close()
+	var stored int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM binance_ads WHERE asset = 'FAST'`).Scan(&stored); err != nil {
+		t.Fatalf("could not count the stored ads: %s", err.Error())
+	}
+	if stored != 2 {
+		t.Errorf("got %d stored ads of the finished pair, want 2", stored)
+	}
+}
+
+func TestMerchantModes(t *testing.T) {
+	boolPtr := func(value bool) *bool { return &value }
+	tests := []struct {
+		name string
+		cfg  configs.Binance
+		want []bool
+	}{
+		{name: "merchants by default", want: []bool{true}},
+		{name: "merchants only", cfg: configs.Binance{MerchantOnly: boolPtr(true)}, want: []bool{true}},
+		{name: "every advertiser", cfg: configs.Binance{MerchantOnly: boolPtr(false)}, want: []bool{false}},
+		{name: "both", cfg: configs.Binance{MerchantOnly: boolPtr(false), MerchantBoth: true}, want: []bool{true, false}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := "MERCHANT" + strconv.Itoa(i)
+			tt.cfg.Assets = []string{asset}
+			tt.cfg.Fiats = []string{"RUB"}
+			var (
+				mu       sync.Mutex
+				requests = make(map[bool]int)
+			)
+			b := newTestBinance(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				mu.Lock()
+				requests[options.MerchantCheck]++
+				mu.Unlock()
+				writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+			})
+			if err := b.GetAllData(context.Background()); err != nil {
+				t.Fatalf("could not get data: %s", err.Error())
+			}
+
+			if len(requests) != len(tt.want) {
+				t.Errorf("got requests by merchantCheck %v, want %v", requests, tt.want)
+			}
+			for _, merchantCheck := range tt.want {
+				// a request of each side with the merchant label of its mode
+				if got := requests[merchantCheck]; got != 2 {
+					t.Errorf("got %d requests with merchantCheck %v, want 2", got, merchantCheck)
+				}
+				option := getOptions(asset, "RUB", defaultRows, merchantCheck, nil)[0]
+				labels, _ := b.labelsFor(&option)
+				if count, _ := observations(t, binancePrice, labels...); count != 1 {
+					t.Errorf("got %d prices labelled merchant=%v, want 1", count, merchantCheck)
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllDataCancel(t *testing.T) {
+	var cancelled atomic.Int32
+	b := newTestBinance(t, configs.Binance{Assets: []string{"HANGA", "HANGB"}, Fiats: []string{"RUB"}}, func(w http.ResponseWriter, r *http.Request) {
+		// the server notices a gone client once the body is read
+		decodeRequest(t, r)
+		select {
+		case <-r.Context().Done():
+			cancelled.Add(1)
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	startTime := time.Now()
+	err := b.GetAllData(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Errorf("GetAllData returned %s after the cancellation", elapsed)
+	}
+	// the server sees the requests in flight go away
+	deadline := time.Now().Add(time.Second)
+	for cancelled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if cancelled.Load() == 0 {
+		t.Errorf("no request in flight was cancelled")
+	}
+}
+
+func TestEndpointFailover(t *testing.T) {
+	var primaryRequests, mirrorRequests atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorRequests.Add(1)
+		options := decodeRequest(t, r)
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	}))
+	t.Cleanup(mirror.Close)
+
+	tests := []struct {
+		name string
+		cfg  configs.Binance
+	}{
+		{name: "addresses", cfg: configs.Binance{Addresses: []string{primary.URL, mirror.URL}}},
+		{name: "fallback addresses", cfg: configs.Binance{Address: primary.URL, FallbackAddresses: []string{mirror.URL}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primaryRequests.Store(0)
+			mirrorRequests.Store(0)
+			b := newTestBinance(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("a request went to the default test server")
+			})
+			failuresBefore := testutil.ToFloat64(binanceEndpointRequests.WithLabelValues(primary.URL, endpointFailure))
+			successesBefore := testutil.ToFloat64(binanceEndpointRequests.WithLabelValues(mirror.URL, endpointSuccess))
+			options := getOptions("FAILOVER", "RUB", defaultRows, true, nil)[0]
+
+			result, err := b.collect(context.Background(), &options)
+			if err != nil {
+				t.Fatalf("could not collect: %s", err.Error())
+			}
+			if len(result.offers) != 1 {
+				t.Errorf("got %d offers, want the offer of the mirror", len(result.offers))
+			}
+			if primaryRequests.Load() != 1 || mirrorRequests.Load() != 1 {
+				t.Errorf("got %d primary and %d mirror requests, want one each", primaryRequests.Load(), mirrorRequests.Load())
+			}
+			if got := testutil.ToFloat64(binanceEndpointRequests.WithLabelValues(primary.URL, endpointFailure)) - failuresBefore; got != 1 {
+				t.Errorf("got %v failures of the primary, want 1", got)
+			}
+			if got := testutil.ToFloat64(binanceEndpointRequests.WithLabelValues(mirror.URL, endpointSuccess)) - successesBefore; got != 1 {
+				t.Errorf("got %v successes of the mirror, want 1", got)
+			}
+		})
+	}
+}
+
+func TestErrorLogAttributes(t *testing.T) {
+	b := newTestBinance(t, configs.Binance{Assets: []string{"LOGGED"}, Fiats: []string{"RUB"}}, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	var output bytes.Buffer
+	b.UseLogger(slog.New(slog.NewJSONHandler(&output, nil)))
+
+	if err := b.GetAllData(context.Background()); err == nil {
+		t.Fatalf("got no error, want the failed requests reported")
+	}
+	records := 0
+	decoder := json.NewDecoder(&output)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("could not decode a log record: %s", err.Error())
+		}
+		if record["msg"] != "could not get data" {
+			continue
+		}
+		records++
+		want := map[string]any{"level": "ERROR", "source": "binance", "asset": "LOGGED", "fiat": "RUB"}
+		for key, value := range want {
+			if record[key] != value {
+				t.Errorf("got %s %v, want %v", key, record[key], value)
+			}
+		}
+		for _, key := range []string{"market", "err"} {
+			if value, ok := record[key].(string); !ok || value == "" {
+				t.Errorf("got %s %v, want it set", key, record[key])
+			}
+		}
+	}
+	if records == 0 {
+		t.Errorf("got no error logs of the failed requests")
+	}
+}
@@ -0,0 +1,113 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBaseDelay = 500 * time.Millisecond
+	defaultMaxDelay  = 10 * time.Second
+)
+
+// statusError is returned for a response with a non 200 status code
+type statusError struct {
+	code       int
+	retryAfter string
+	err        error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// attemptBudget is the attempts a request has across every endpoint,
+// maxRetries+1 of them but at least one per endpoint
+func (b *Binance) attemptBudget() int {
+	return max(b.config.MaxRetries+1, len(b.endpoints))
+}
+
+// postWithRetry posts the body to the endpoint, retrying 429, 5xx and timed
+// out requests with exponential backoff; every attempt is taken from attempts,
+// which keeps one attempt for each of the later endpoints
+func (b *Binance) postWithRetry(
+	ctx context.Context,
+	client *pairClient,
+	endpoint endpoint,
+	requestId string,
+	body []byte,
+	attempts *int,
+	laterEndpoints int,
+) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := b.post(ctx, client, endpoint, requestId, body)
+		*attempts--
+		if err == nil {
+			return response, nil
+		}
+		hint, ok := retryable(err)
+		if !ok || *attempts <= laterEndpoints {
+			return nil, err
+		}
+		delay := b.backoffDelay(attempt, hint)
+		b.logger.Warn("request failed, retrying", "requestId", requestId, "address", endpoint.address, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether the error is worth retrying and the delay the server asked for
+func retryable(err error) (time.Duration, bool) {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		if statusErr.code == http.StatusTooManyRequests {
+			return parseRetryAfter(statusErr.retryAfter), true
+		}
+		return 0, statusErr.code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter accepts both the seconds and the http date forms of the header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func (b *Binance) backoffDelay(attempt int, hint time.Duration) time.Duration {
+	maxDelay := time.Duration(b.config.MaxDelayInMilliseconds) * time.Millisecond
+	delay := time.Duration(b.config.BaseDelayInMilliseconds) * time.Millisecond << attempt
+	if hint > 0 {
+		delay = hint
+	}
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
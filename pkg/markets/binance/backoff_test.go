@@ -0,0 +1,269 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "missing", value: "", want: 0},
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "malformed", value: "soon", want: 0},
+		{name: "past date", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if tt.want < 0 {
+				if got >= 0 {
+					t.Errorf("got %s, want a negative delay", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got <= 55*time.Second || got > time.Minute {
+		t.Errorf("got %s for a date a minute ahead, want about a minute", got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHint time.Duration
+		wantOk   bool
+	}{
+		{
+			name:     "too many requests",
+			err:      &statusError{code: http.StatusTooManyRequests, retryAfter: "2", err: errors.New("429")},
+			wantHint: 2 * time.Second,
+			wantOk:   true,
+		},
+		{
+			name:   "server error",
+			err:    fmt.Errorf("wrapped: %w", &statusError{code: http.StatusBadGateway, err: errors.New("502")}),
+			wantOk: true,
+		},
+		{
+			name: "client error",
+			err:  &statusError{code: http.StatusBadRequest, err: errors.New("400")},
+		},
+		{
+			name:   "timeout",
+			err:    fmt.Errorf("could not send: %w", timeoutError{}),
+			wantOk: true,
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint, ok := retryable(tt.err)
+			if hint != tt.wantHint || ok != tt.wantOk {
+				t.Errorf("got %s, %v, want %s, %v", hint, ok, tt.wantHint, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := &Binance{config: configs.Binance{BaseDelayInMilliseconds: 500, MaxDelayInMilliseconds: 10000}}
+	tests := []struct {
+		name    string
+		attempt int
+		hint    time.Duration
+		want    time.Duration
+	}{
+		{name: "first retry", attempt: 0, want: 500 * time.Millisecond},
+		{name: "doubles", attempt: 2, want: 2 * time.Second},
+		{name: "capped", attempt: 10, want: 10 * time.Second},
+		{name: "retry after", attempt: 3, hint: 1500 * time.Millisecond, want: 1500 * time.Millisecond},
+		{name: "retry after beyond the cap", attempt: 0, hint: time.Minute, want: 10 * time.Second},
+		{name: "shift overflow", attempt: 80, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.backoffDelay(tt.attempt, tt.hint); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		failures     int32
+		status       int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{name: "recovers from a 503", maxRetries: 3, failures: 1, status: http.StatusServiceUnavailable, wantRequests: 2},
+		{name: "recovers from a 429", maxRetries: 3, failures: 2, status: http.StatusTooManyRequests, wantRequests: 3},
+		{name: "gives up after maxRetries", maxRetries: 2, failures: 5, status: http.StatusInternalServerError, wantRequests: 3, wantErr: true},
+		{name: "does not retry a 400", maxRetries: 3, failures: 1, status: http.StatusBadRequest, wantRequests: 1, wantErr: true},
+		{name: "does not retry by default", failures: 1, status: http.StatusServiceUnavailable, wantRequests: 1, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			cfg := configs.Binance{MaxRetries: tt.maxRetries, BaseDelayInMilliseconds: 1, MaxDelayInMilliseconds: 10}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				if requests.Add(1) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "try again", tt.status)
+					return
+				}
+				writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+			})
+			options := getOptions(fmt.Sprintf("RETRY%d", i), "RUB", defaultRows, true, nil)[0]
+
+			_, err := b.collect(context.Background(), &options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxRetries    int
+		primaryStatus int
+		wantPrimary   int32
+		wantMirror    int32
+	}{
+		{name: "retries and fallback share the budget", maxRetries: 3, primaryStatus: http.StatusServiceUnavailable, wantPrimary: 3, wantMirror: 1},
+		{name: "every endpoint is tried once without retries", primaryStatus: http.StatusServiceUnavailable, wantPrimary: 1, wantMirror: 1},
+		{name: "a 400 falls back at once", maxRetries: 3, primaryStatus: http.StatusBadRequest, wantPrimary: 1, wantMirror: 3},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryRequests, mirrorRequests atomic.Int32
+			failing := func(requests *atomic.Int32, status int) *httptest.Server {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests.Add(1)
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "unavailable", status)
+				}))
+				t.Cleanup(server.Close)
+				return server
+			}
+			primary := failing(&primaryRequests, tt.primaryStatus)
+			mirror := failing(&mirrorRequests, http.StatusServiceUnavailable)
+			cfg := configs.Binance{
+				Addresses:               []string{primary.URL, mirror.URL},
+				MaxRetries:              tt.maxRetries,
+				BaseDelayInMilliseconds: 1,
+				MaxDelayInMilliseconds:  10,
+			}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("a request went to the default test server")
+			})
+			options := getOptions(fmt.Sprintf("BUDGET%d", i), "RUB", defaultRows, true, nil)[0]
+
+			if _, err := b.collect(context.Background(), &options); err == nil {
+				t.Fatalf("got no error, want the failure of the last endpoint")
+			}
+			if got, want := primaryRequests.Load()+mirrorRequests.Load(), int32(max(tt.maxRetries+1, 2)); got != want {
+				t.Errorf("got %d attempts, want %d", got, want)
+			}
+			if primaryRequests.Load() != tt.wantPrimary || mirrorRequests.Load() != tt.wantMirror {
+				t.Errorf("got %d primary and %d mirror requests, want %d and %d",
+					primaryRequests.Load(), mirrorRequests.Load(), tt.wantPrimary, tt.wantMirror)
+			}
+		})
+	}
+}
+
+func TestErrorCodeRetry(t *testing.T) {
+	const code = "100001"
+	tests := []struct {
+		name         string
+		failures     int32
+		cancelAfter  time.Duration
+		baseDelay    int64
+		wantRequests int32
+		wantDelay    time.Duration
+		wantErr      bool
+	}{
+		{name: "backs off before each retry", failures: 2, baseDelay: 20, wantRequests: 3, wantDelay: 60 * time.Millisecond},
+		{name: "gives up after errorCodeRetries", failures: 5, baseDelay: 1, wantRequests: 3, wantErr: true},
+		{name: "cancelled while backing off", failures: 5, baseDelay: 10000, cancelAfter: 50 * time.Millisecond, wantRequests: 1, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			cfg := configs.Binance{
+				RetryErrorCodes:         []string{code},
+				ErrorCodeRetries:        2,
+				BaseDelayInMilliseconds: tt.baseDelay,
+				MaxDelayInMilliseconds:  10000,
+			}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				if requests.Add(1) <= tt.failures {
+					fmt.Fprintf(w, `{"code":%q,"success":false,"data":[]}`, code)
+					return
+				}
+				writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+			})
+			options := getOptions(fmt.Sprintf("CODE%d", i), "RUB", defaultRows, true, nil)[0]
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAfter != 0 {
+				time.AfterFunc(tt.cancelAfter, cancel)
+			}
+
+			startTime := time.Now()
+			_, err := b.collect(ctx, &options)
+			elapsed := time.Since(startTime)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+			if elapsed < tt.wantDelay {
+				t.Errorf("retried within %s, want to back off for at least %s", elapsed, tt.wantDelay)
+			}
+			if elapsed > 5*time.Second {
+				t.Errorf("collecting took %s, want the backoff cut short", elapsed)
+			}
+		})
+	}
+}
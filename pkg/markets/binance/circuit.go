@@ -0,0 +1,118 @@
+package binance
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func init() {
+	prometheus.MustRegister(binancePairCircuitOpen)
+}
+
+var binancePairCircuitOpen = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "pair_circuit_open",
+		Help:      "1 while a pair is skipped after consecutive failures, 0 otherwise.",
+	},
+	[]string{"asset", "fiat"},
+)
+
+// pairCircuits stops scraping a pair for a cooldown after it fails
+// FailureThreshold cycles in a row, a nil config never opens a circuit
+type pairCircuits struct {
+	config *configs.PairCircuit
+
+	mu       sync.Mutex
+	failures map[string]int
+	openedAt map[string]time.Time
+}
+
+func newPairCircuits(cfg *configs.PairCircuit) *pairCircuits {
+	return &pairCircuits{
+		config:   cfg,
+		failures: make(map[string]int),
+		openedAt: make(map[string]time.Time),
+	}
+}
+
+func pairKey(asset, fiat string) string {
+	return asset + "/" + fiat
+}
+
+// allow tells whether the pair may be scraped, once the cooldown is over
+// the pair gets a single attempt before the circuit opens again
+func (c *pairCircuits) allow(asset, fiat string) bool {
+	if c.config == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	openedAt, open := c.openedAt[pairKey(asset, fiat)]
+	if !open {
+		return true
+	}
+	cooldown := time.Duration(c.config.CooldownInSeconds) * time.Second
+	return time.Since(openedAt) >= cooldown
+}
+
+func (c *pairCircuits) record(asset, fiat string, failed bool) {
+	if c.config == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := pairKey(asset, fiat)
+	if !failed {
+		delete(c.failures, key)
+		delete(c.openedAt, key)
+		binancePairCircuitOpen.WithLabelValues(asset, fiat).Set(0)
+		return
+	}
+
+	c.failures[key]++
+	if c.failures[key] >= c.config.FailureThreshold {
+		if _, open := c.openedAt[key]; !open {
+			slog.Warn("pair keeps failing, skipping it",
+				"source", "binance", "asset", asset, "fiat", fiat,
+				"failures", c.failures[key], "cooldownInSeconds", c.config.CooldownInSeconds)
+		}
+		c.openedAt[key] = time.Now()
+		binancePairCircuitOpen.WithLabelValues(asset, fiat).Set(1)
+	}
+}
+
+// pairRound gathers the request results of a cycle, a pair fails the cycle
+// only when none of its requests succeeded
+type pairRound struct {
+	circuits *pairCircuits
+
+	mu        sync.Mutex
+	succeeded map[[2]string]bool
+}
+
+func (c *pairCircuits) newRound() *pairRound {
+	return &pairRound{circuits: c, succeeded: make(map[[2]string]bool)}
+}
+
+func (r *pairRound) add(asset, fiat string, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair := [2]string{asset, fiat}
+	r.succeeded[pair] = r.succeeded[pair] || !failed
+}
+
+// close records a single result of every pair in the circuits
+func (r *pairRound) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for pair, succeeded := range r.succeeded {
+		r.circuits.record(pair[0], pair[1], !succeeded)
+	}
+}
@@ -0,0 +1,68 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestPairCircuitCountsCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      configs.Binance
+		failing  map[string]bool
+		cycles   int
+		wantOpen bool
+	}{
+		{
+			name:    "one failing cycle of both sides",
+			cfg:     configs.Binance{Assets: []string{"CIRCA"}},
+			failing: map[string]bool{buyTradeType: true, sellTradeType: true},
+			cycles:  1,
+		},
+		{
+			name:     "failing cycles reach the threshold",
+			cfg:      configs.Binance{Assets: []string{"CIRCB"}},
+			failing:  map[string]bool{buyTradeType: true, sellTradeType: true},
+			cycles:   2,
+			wantOpen: true,
+		},
+		{
+			name:    "a side keeps succeeding",
+			cfg:     configs.Binance{Assets: []string{"CIRCC"}},
+			failing: map[string]bool{sellTradeType: true},
+			cycles:  3,
+		},
+		{
+			name:     "pair level requests",
+			cfg:      configs.Binance{Assets: []string{"CIRCD"}, MidPrice: true},
+			failing:  map[string]bool{buyTradeType: true, sellTradeType: true},
+			cycles:   2,
+			wantOpen: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Fiats = []string{"RUB"}
+			cfg.PairCircuit = &configs.PairCircuit{FailureThreshold: 2, CooldownInSeconds: 3600}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				if tt.failing[options.TradeType] {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+			})
+
+			for i := 0; i < tt.cycles; i++ {
+				_ = b.GetAllData(context.Background())
+			}
+			if open := !b.circuits.allow(cfg.Assets[0], "RUB"); open != tt.wantOpen {
+				t.Errorf("got an open circuit %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/proxy"
+)
+
+// pairClient is an http client shared by the pairs that reference it by name
+type pairClient struct {
+	httpClient http.Client
+	headers    map[string]string
+	// fixedTimeout clients ignore the adaptive timeout
+	fixedTimeout bool
+}
+
+// newPairClients creates the default client and the named ones,
+// a named client without a proxy goes through the default proxy
+func newPairClients(cfgs []configs.HttpClient, defaultProxy string) (map[string]*pairClient, error) {
+	transport, err := proxy.Transport(defaultProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	clients := map[string]*pairClient{
+		"": {httpClient: http.Client{Timeout: defaultTimeout, Transport: transport}},
+	}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("client name must not be empty")
+		}
+		if _, ok := clients[cfg.Name]; ok {
+			return nil, fmt.Errorf("client %s is defined twice", cfg.Name)
+		}
+		client := &pairClient{
+			httpClient: http.Client{Timeout: defaultTimeout, Transport: transport},
+			headers:    cfg.Headers,
+		}
+		if cfg.TimeoutInSeconds != 0 {
+			client.httpClient.Timeout = time.Duration(cfg.TimeoutInSeconds) * time.Second
+			client.fixedTimeout = true
+		}
+		if cfg.Proxy != "" {
+			client.httpClient.Transport, err = proxy.Transport(cfg.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy of client %s: %w", cfg.Name, err)
+			}
+		}
+		clients[cfg.Name] = client
+	}
+	return clients, nil
+}
+
+// UseTransport sends the requests of every client through the round tripper,
+// it replaces the proxies of the config and lets tests serve canned responses
+func (b *Binance) UseTransport(transport http.RoundTripper) {
+	for _, client := range b.clients {
+		client.httpClient.Transport = transport
+	}
+}
+
+// setTimeouts applies the adaptive timeout to every client without a fixed one
+func (b *Binance) setTimeouts(timeout time.Duration) {
+	for _, client := range b.clients {
+		if !client.fixedTimeout {
+			client.httpClient.Timeout = timeout
+		}
+	}
+}
+
+// clientFor returns the client of the pair, pairs without one share the default client
+func (b *Binance) clientFor(asset, fiat string) *pairClient {
+	for _, pair := range b.config.Pairs {
+		if pair.Asset == asset && pair.Fiat == fiat && pair.Client != "" {
+			return b.clients[pair.Client]
+		}
+	}
+	return b.clients[""]
+}
+
+// setHeaders sets the user agent and the extra headers of the config,
+// the headers of the client take precedence over them
+func (b *Binance) setHeaders(request *http.Request, client *pairClient) {
+	if b.config.UserAgent != "" {
+		request.Header.Set("User-Agent", b.config.UserAgent)
+	}
+	for name, value := range b.config.Headers {
+		request.Header.Set(name, value)
+	}
+	for name, value := range client.headers {
+		request.Header.Set(name, value)
+	}
+}
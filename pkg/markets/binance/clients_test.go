@@ -0,0 +1,101 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	cfg := configs.Binance{
+		Assets:    []string{"HEADA", "HEADB"},
+		Fiats:     []string{"RUB"},
+		UserAgent: "Mozilla/5.0 test",
+		Headers:   map[string]string{"Cookie": "session=1", "X-Extra": "global"},
+		Clients:   []configs.HttpClient{{Name: "special", Headers: map[string]string{"X-Extra": "client"}}},
+		Pairs:     []configs.Pair{{Asset: "HEADB", Fiat: "RUB", Client: "special"}},
+	}
+	var (
+		mu      sync.Mutex
+		headers = make(map[string]http.Header)
+	)
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		options := decodeRequest(t, r)
+		mu.Lock()
+		headers[options.Asset] = r.Header.Clone()
+		mu.Unlock()
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	})
+	if err := b.GetAllData(context.Background()); err != nil {
+		t.Fatalf("could not get data: %s", err.Error())
+	}
+
+	want := map[string]map[string]string{
+		"HEADA": {"User-Agent": "Mozilla/5.0 test", "Cookie": "session=1", "X-Extra": "global", "Content-Type": "application/json"},
+		// the headers of the client take precedence over the global ones
+		"HEADB": {"User-Agent": "Mozilla/5.0 test", "Cookie": "session=1", "X-Extra": "client", "Content-Type": "application/json"},
+	}
+	for asset, wantHeaders := range want {
+		got, ok := headers[asset]
+		if !ok {
+			t.Fatalf("got no request of %s", asset)
+		}
+		for name, value := range wantHeaders {
+			if got.Get(name) != value {
+				t.Errorf("%s: got %s %q, want %q", asset, name, got.Get(name), value)
+			}
+		}
+		if got.Get(defaultRequestIdHeader) == "" {
+			t.Errorf("%s: got no %s", asset, defaultRequestIdHeader)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "p2p.binance.test" {
+			t.Errorf("got a proxied request for %s, want one for the binance address", r.URL)
+		}
+		proxied.Add(1)
+		options := decodeRequest(t, r)
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	}))
+	t.Cleanup(proxy.Close)
+
+	tests := []struct {
+		name string
+		cfg  configs.Binance
+	}{
+		{name: "default client", cfg: configs.Binance{Proxy: proxy.URL}},
+		{
+			name: "named client",
+			cfg: configs.Binance{
+				Clients: []configs.HttpClient{{Name: "proxied", Proxy: proxy.URL}},
+				Pairs:   []configs.Pair{{Asset: "PROXY", Fiat: "RUB", Client: "proxied"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxied.Store(0)
+			// the address does not resolve, only the proxy can answer
+			tt.cfg.Address = "http://p2p.binance.test/search"
+			b := newTestBinance(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {})
+			options := getOptions("PROXY", "RUB", defaultRows, true, nil)[0]
+
+			result, err := b.collect(context.Background(), &options)
+			if err != nil {
+				t.Fatalf("could not collect: %s", err.Error())
+			}
+			if len(result.offers) != 1 || proxied.Load() != 1 {
+				t.Errorf("got %d offers through %d proxied requests, want one", len(result.offers), proxied.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func init() {
+	prometheus.MustRegister(binanceClockSkew)
+}
+
+var binanceClockSkew = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "clock_skew_seconds",
+		Help:      "Binance server time minus the local time, added to the timestamp of signed requests.",
+	},
+)
+
+// serverClock keeps the offset of the binance server time to the local clock
+type serverClock struct {
+	mu     sync.Mutex
+	synced bool
+	// offset is in milliseconds
+	offset atomic.Int64
+}
+
+// now returns the local time moved by the measured offset
+func (c *serverClock) now() time.Time {
+	return time.Now().Add(time.Duration(c.offset.Load()) * time.Millisecond)
+}
+
+// syncClock measures the offset to the server time once, a failed
+// measurement keeps the local time and is tried again next cycle
+func (b *Binance) syncClock(ctx context.Context) {
+	if b.config.ServerTimeAddress == "" {
+		return
+	}
+	b.clock.mu.Lock()
+	defer b.clock.mu.Unlock()
+	if b.clock.synced {
+		return
+	}
+
+	offset, err := b.getClockOffset(ctx)
+	if err != nil {
+		b.logger.Error("could not sync with the server time", "err", err)
+		return
+	}
+	b.clock.offset.Store(offset.Milliseconds())
+	b.clock.synced = true
+	binanceClockSkew.Set(offset.Seconds())
+	b.logger.Info("synced with the server time", "offset", offset)
+}
+
+// getClockOffset compares the server time to the local time halfway through the request
+func (b *Binance) getClockOffset(ctx context.Context) (time.Duration, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.config.ServerTimeAddress, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not create a server time request: %w", err)
+	}
+	b.setHeaders(request, b.clients[""])
+	if err = b.wait(ctx); err != nil {
+		return 0, fmt.Errorf("could not wait for the rate limiter: %w", err)
+	}
+
+	sentTime := time.Now()
+	response, err := b.clients[""].httpClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("could not send a server time request: %w", err)
+	}
+	defer response.Body.Close()
+	receivedTime := time.Now()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, fmt.Errorf("could not read a server time responce body: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unsuccessfull server time request, status code %d", response.StatusCode)
+	}
+
+	var serverTime models.BinanceServerTime
+	if err = json.Unmarshal(responseBody, &serverTime); err != nil {
+		return 0, fmt.Errorf("could not unmarshal a server time responce body: %w", err)
+	}
+	if serverTime.ServerTime == 0 {
+		return 0, fmt.Errorf("server time responce has no serverTime")
+	}
+	localTime := sentTime.Add(receivedTime.Sub(sentTime) / 2)
+	return time.UnixMilli(serverTime.ServerTime).Sub(localTime), nil
+}
@@ -0,0 +1,98 @@
+package binance
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+const (
+	defaultCorrelationWindow = 500
+	// fewer samples than this give no meaningful correlation
+	minCorrelationSamples = 10
+)
+
+func init() {
+	prometheus.MustRegister(binancePriceQuantityCorrelation)
+}
+
+var binancePriceQuantityCorrelation = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "price_quantity_corr",
+		Help:      "Pearson correlation of offer price and tradable quantity over the recent window.",
+	},
+	binanceLabels,
+)
+
+// rollingCorrelation keeps the last window (price, quantity) samples of a
+// series, the Pearson correlation is computed from them, running sums of
+// squares lose the variance of large prices that barely move
+type rollingCorrelation struct {
+	xs, ys []float64
+	next   int
+	window int
+}
+
+func newRollingCorrelation(window int) *rollingCorrelation {
+	return &rollingCorrelation{
+		xs:     make([]float64, 0, window),
+		ys:     make([]float64, 0, window),
+		window: window,
+	}
+}
+
+func (r *rollingCorrelation) add(x, y float64) {
+	if len(r.xs) == r.window {
+		r.xs[r.next], r.ys[r.next] = x, y
+		r.next = (r.next + 1) % r.window
+		return
+	}
+	r.xs = append(r.xs, x)
+	r.ys = append(r.ys, y)
+}
+
+// value is not ok until there are minCorrelationSamples samples
+// or while either series has no variance
+func (r *rollingCorrelation) value() (float64, bool) {
+	if len(r.xs) < minCorrelationSamples {
+		return 0, false
+	}
+	n := float64(len(r.xs))
+	var sumX, sumY float64
+	for i := range r.xs {
+		sumX += r.xs[i]
+		sumY += r.ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var covariance, varianceX, varianceY float64
+	for i := range r.xs {
+		dx, dy := r.xs[i]-meanX, r.ys[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX <= 0 || varianceY <= 0 {
+		return 0, false
+	}
+	return covariance / math.Sqrt(varianceX*varianceY), true
+}
+
+func (b *Binance) observeCorrelation(options *models.BinanceRequest, labels []string, offers []models.Offer) {
+	b.correlationMu.Lock()
+	defer b.correlationMu.Unlock()
+
+	key := marketKey(options)
+	correlation, ok := b.correlations[key]
+	if !ok {
+		correlation = newRollingCorrelation(b.config.CorrelationWindow)
+		b.correlations[key] = correlation
+	}
+	for _, offer := range offers {
+		correlation.add(offer.Price, offer.TradableQuantity)
+	}
+	if value, ok := correlation.value(); ok {
+		binancePriceQuantityCorrelation.WithLabelValues(labels...).Set(value)
+	}
+}
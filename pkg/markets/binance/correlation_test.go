@@ -0,0 +1,83 @@
+package binance
+
+import (
+	"math"
+	"testing"
+)
+
+// samplePair is a (price, quantity) sample
+type samplePair struct {
+	x, y float64
+}
+
+// repeatPairs returns count copies of the pairs one after another
+func repeatPairs(count int, pairs ...samplePair) []samplePair {
+	repeated := make([]samplePair, 0, count*len(pairs))
+	for i := 0; i < count; i++ {
+		repeated = append(repeated, pairs...)
+	}
+	return repeated
+}
+
+func TestRollingCorrelation(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  int
+		samples []samplePair
+		want    float64
+		wantOk  bool
+	}{
+		{
+			name:    "warm up",
+			window:  100,
+			samples: repeatPairs(minCorrelationSamples/2-1, samplePair{1, 1}, samplePair{2, 2}),
+		},
+		{
+			name:    "no variance",
+			window:  100,
+			samples: repeatPairs(minCorrelationSamples, samplePair{1, 5}),
+		},
+		{
+			name:    "correlated",
+			window:  100,
+			samples: repeatPairs(5, samplePair{1, 10}, samplePair{2, 20}),
+			want:    1,
+			wantOk:  true,
+		},
+		{
+			name:    "anticorrelated",
+			window:  100,
+			samples: repeatPairs(5, samplePair{1, 20}, samplePair{2, 10}),
+			want:    -1,
+			wantOk:  true,
+		},
+		{
+			// large prices that barely move lose every digit of their variance
+			// in running sums of squares, more so with every eviction
+			name:   "large prices over many evictions",
+			window: 100,
+			samples: append(
+				repeatPairs(1000, samplePair{5e7, 1}, samplePair{6e7, 3}),
+				repeatPairs(50000, samplePair{1e7, 20}, samplePair{1e7 + 0.01, 10})...,
+			),
+			want:   -1,
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			correlation := newRollingCorrelation(tt.window)
+			for _, sample := range tt.samples {
+				correlation.add(sample.x, sample.y)
+			}
+
+			got, ok := correlation.value()
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("got correlation %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package binance
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+const (
+	buyTradeType  = "BUY"
+	sellTradeType = "SELL"
+
+	defaultBestN = 5
+)
+
+func init() {
+	prometheus.MustRegister(binanceBestNAvgPrice)
+	prometheus.MustRegister(binanceTrimmedMeanPrice)
+	prometheus.MustRegister(binanceMethodOfferCount)
+	prometheus.MustRegister(binanceOfferDecay)
+	prometheus.MustRegister(binanceLiquidityWithinBand)
+	prometheus.MustRegister(binanceMidPrice)
+	prometheus.MustRegister(binanceSpread)
+	prometheus.MustRegister(binanceSpreadStale)
+}
+
+var (
+	binanceBestNAvgPrice = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "best_n_avg_price",
+			Help:      "Average price of the best N offers, in fiat per asset unit.",
+		},
+		binanceLabels,
+	)
+	binanceTrimmedMeanPrice = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "trimmed_mean_price",
+			Help:      "Trimmed mean price of the offers, in fiat per asset unit.",
+		},
+		binanceLabels,
+	)
+	binanceMethodOfferCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "method_offer_count",
+			Help:      "Offers accepting a payment method.",
+		},
+		withLabels("payMethod"),
+	)
+	binanceOfferDecay = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "offer_decay_percent",
+			Help:      "Price difference between the best offer and the offer of a rank, in percent.",
+		},
+		withLabels("rank"),
+	)
+	binanceLiquidityWithinBand = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "liquidity_within_band",
+			Help:      "Tradable quantity of the offers priced within a band around the best price, in asset units.",
+		},
+		withLabels("bandPercent"),
+	)
+	binanceMidPrice = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "mid_price",
+			Help:      "Mean of the best BUY and the best SELL price of a pair, in fiat per asset unit.",
+		},
+		pairLabels,
+	)
+	binanceSpread = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "spread",
+			Help:      "Best SELL price minus the best BUY price of a pair, in fiat per asset unit.",
+		},
+		pairLabels,
+	)
+	binanceSpreadStale = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "spread_stale",
+			Help:      "1 while the sides of a pair were scraped too far apart for binance_spread, 0 otherwise.",
+		},
+		pairLabels,
+	)
+)
+
+// sortedByBest returns the offers ordered from the best price to the worst one:
+// the cheapest first for BUY and the most expensive first for SELL
+func sortedByBest(offers []models.Offer, tradeType string) []models.Offer {
+	sorted := append([]models.Offer(nil), offers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if tradeType == sellTradeType {
+			return sorted[i].Price > sorted[j].Price
+		}
+		return sorted[i].Price < sorted[j].Price
+	})
+	return sorted
+}
+
+// bestNAverage averages the prices of the first n sorted offers,
+// or of all of them when there are fewer than n
+func bestNAverage(offers []models.Offer, n int) float64 {
+	if n > len(offers) {
+		n = len(offers)
+	}
+	var sum float64
+	for _, offer := range offers[:n] {
+		sum += offer.Price
+	}
+	return sum / float64(n)
+}
+
+// trimmedMean drops fraction of the sorted offers from each end and averages
+// the rest, small samples that would be trimmed away entirely are averaged as is
+func trimmedMean(offers []models.Offer, fraction float64) float64 {
+	trim := int(float64(len(offers)) * fraction)
+	if 2*trim >= len(offers) {
+		trim = 0
+	}
+	var sum float64
+	kept := offers[trim : len(offers)-trim]
+	for _, offer := range kept {
+		sum += offer.Price
+	}
+	return sum / float64(len(kept))
+}
+
+// methodOfferCounts counts the offers supporting each of the given methods
+func methodOfferCounts(offers []models.Offer, payMethods []string) map[string]int {
+	counts := make(map[string]int, len(payMethods))
+	for _, payMethod := range payMethods {
+		counts[payMethod] = 0
+	}
+	for _, offer := range offers {
+		for _, payMethod := range offer.PayMethods {
+			if _, ok := counts[payMethod]; ok {
+				counts[payMethod]++
+			}
+		}
+	}
+	return counts
+}
+
+// offerDecay tells in percent how much worse the offer of the 1-based rank
+// is than the best one, ok is false when there are fewer offers than rank
+func offerDecay(offers []models.Offer, rank int) (decay float64, ok bool) {
+	if rank < 1 || rank > len(offers) || offers[0].Price == 0 {
+		return 0, false
+	}
+	best := offers[0].Price
+	return math.Abs(offers[rank-1].Price-best) / best * 100, true
+}
+
+// liquidityWithinBand sums the tradable quantity of the sorted offers priced
+// within bandPercent of the best offer
+func liquidityWithinBand(offers []models.Offer, bandPercent float64) float64 {
+	var quantity float64
+	best := offers[0].Price
+	for _, offer := range offers {
+		if math.Abs(offer.Price-best) > best*bandPercent/100 {
+			break
+		}
+		quantity += offer.TradableQuantity
+	}
+	return quantity
+}
+
+func (b *Binance) observeDerived(options *models.BinanceRequest, labels []string, offers []models.Offer) {
+	if len(offers) == 0 {
+		return
+	}
+	offers = sortedByBest(offers, options.TradeType)
+
+	binanceBestNAvgPrice.WithLabelValues(labels...).Set(bestNAverage(offers, b.config.BestN))
+	binanceTrimmedMeanPrice.WithLabelValues(labels...).Set(trimmedMean(offers, b.config.TrimFraction))
+	b.observeCorrelation(options, labels, offers)
+	b.observeZScore(options, labels, offers)
+	b.observePercentiles(labels, offers)
+	for _, rank := range b.config.DecayRanks {
+		if decay, ok := offerDecay(offers, rank); ok {
+			binanceOfferDecay.WithLabelValues(append(labels, strconv.Itoa(rank))...).Set(decay)
+		}
+	}
+	for _, bandPercent := range b.config.LiquidityBands {
+		binanceLiquidityWithinBand.WithLabelValues(
+			append(labels, strconv.FormatFloat(bandPercent, 'f', -1, 64))...,
+		).Set(liquidityWithinBand(offers, bandPercent))
+	}
+	for payMethod, count := range methodOfferCounts(offers, b.config.PayMethods) {
+		binanceMethodOfferCount.WithLabelValues(append(labels, payMethod)...).Set(float64(count))
+	}
+}
+
+// pairBests returns the best BUY and the best SELL price of a pair and how far
+// apart the sides were scraped, ok is false while a side has no offers
+func pairBests(results []*sideResult) (bestBuy, bestSell float64, apart time.Duration, ok bool) {
+	bests := make(map[string]*sideResult, len(results))
+	for _, result := range results {
+		if len(result.offers) != 0 {
+			bests[result.options.TradeType] = result
+		}
+	}
+	buy, okBuy := bests[buyTradeType]
+	sell, okSell := bests[sellTradeType]
+	if !okBuy || !okSell {
+		return 0, 0, 0, false
+	}
+	apart = buy.scrapedAt.Sub(sell.scrapedAt)
+	if apart < 0 {
+		apart = -apart
+	}
+	return bestPrice(buy.offers, buyTradeType), bestPrice(sell.offers, sellTradeType), apart, true
+}
+
+// observePairPrices exposes the mid price and the spread of a pair, nothing is
+// exposed while a side has no offers; the spread of sides scraped further apart
+// than the tolerance is removed and marked stale instead
+func (b *Binance) observePairPrices(options *models.BinanceRequest, results []*sideResult) {
+	bestBuy, bestSell, apart, ok := pairBests(results)
+	if !ok {
+		return
+	}
+	labels, keep := b.pairLabelsFor(options)
+	if !keep {
+		return
+	}
+	if b.config.MidPrice {
+		binanceMidPrice.WithLabelValues(labels...).Set((bestBuy + bestSell) / 2)
+	}
+	if !b.config.Spread {
+		return
+	}
+	tolerance := time.Duration(b.config.SpreadToleranceInMilliseconds) * time.Millisecond
+	if tolerance > 0 && apart > tolerance {
+		binanceSpread.DeleteLabelValues(labels...)
+		binanceSpreadStale.WithLabelValues(labels...).Set(1)
+		return
+	}
+	binanceSpread.WithLabelValues(labels...).Set(bestSell - bestBuy)
+	binanceSpreadStale.WithLabelValues(labels...).Set(0)
+}
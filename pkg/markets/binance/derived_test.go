@@ -0,0 +1,59 @@
+package binance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func TestObservePairPricesFreshness(t *testing.T) {
+	scrapedAt := time.Now()
+	tests := []struct {
+		name       string
+		asset      string
+		tolerance  int64
+		apart      time.Duration
+		wantSpread bool
+	}{
+		{name: "no tolerance", asset: "FRESHA", apart: time.Minute, wantSpread: true},
+		{name: "within the tolerance", asset: "FRESHB", tolerance: 500, apart: 100 * time.Millisecond, wantSpread: true},
+		{name: "beyond the tolerance", asset: "FRESHC", tolerance: 500, apart: 2 * time.Second},
+		{name: "sell scraped first", asset: "FRESHD", tolerance: 500, apart: -2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(configs.Binance{
+				Assets:                        []string{tt.asset},
+				Fiats:                         []string{"RUB"},
+				Spread:                        true,
+				SpreadToleranceInMilliseconds: tt.tolerance,
+			})
+			if err != nil {
+				t.Fatalf("could not create binance: %s", err.Error())
+			}
+			options := getOptions(tt.asset, "RUB", defaultRows, true, nil)
+			results := []*sideResult{
+				{options: &options[0], offers: []models.Offer{{Price: 90}}, scrapedAt: scrapedAt},
+				{options: &options[1], offers: []models.Offer{{Price: 94}}, scrapedAt: scrapedAt.Add(tt.apart)},
+			}
+			labels, _ := b.pairLabelsFor(&options[0])
+
+			b.observePairPrices(&options[0], results)
+			wantStale := 1.0
+			if tt.wantSpread {
+				wantStale = 0
+				if got := testutil.ToFloat64(binanceSpread.WithLabelValues(labels...)); got != 4 {
+					t.Errorf("got a spread of %v, want 4", got)
+				}
+			} else if binanceSpread.DeleteLabelValues(labels...) {
+				t.Errorf("the spread of sides scraped %s apart is exported", tt.apart)
+			}
+			if got := testutil.ToFloat64(binanceSpreadStale.WithLabelValues(labels...)); got != wantStale {
+				t.Errorf("got spread stale %v, want %v", got, wantStale)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package binance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+const (
+	defaultDiscoveryAddress  = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/portal/config"
+	defaultDiscoveryInterval = 24 * time.Hour
+	defaultMaxAssets         = 20
+)
+
+// discovery keeps the assets binance lists as tradable for each fiat
+type discovery struct {
+	config configs.Discovery
+	filter *regexp.Regexp
+
+	mu        sync.Mutex
+	assets    map[string][]string
+	refreshed time.Time
+}
+
+// newDiscovery returns nil when discovery is not configured
+func newDiscovery(cfg *configs.Discovery) (*discovery, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	d := &discovery{config: *cfg, assets: make(map[string][]string)}
+	if d.config.Address == "" {
+		d.config.Address = defaultDiscoveryAddress
+	}
+	if d.config.IntervalInHours == 0 {
+		d.config.IntervalInHours = int64(defaultDiscoveryInterval / time.Hour)
+	}
+	if d.config.MaxAssets == 0 {
+		d.config.MaxAssets = defaultMaxAssets
+	}
+	if d.config.Regex != "" {
+		filter, err := regexp.Compile("^(?:" + d.config.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("could not compile discovery regex: %w", err)
+		}
+		d.filter = filter
+	}
+	return d, nil
+}
+
+// discover refreshes the discovered assets once the interval has passed,
+// a fiat that could not be refreshed keeps its previous assets
+func (b *Binance) discover(ctx context.Context) {
+	if b.discovery == nil {
+		return
+	}
+	d := b.discovery
+	d.mu.Lock()
+	due := time.Since(d.refreshed) >= time.Duration(d.config.IntervalInHours)*time.Hour
+	d.mu.Unlock()
+	if !due {
+		return
+	}
+
+	for _, fiat := range b.config.Fiats {
+		assets, err := b.getTradableAssets(ctx, fiat)
+		if err != nil {
+			b.logger.Error("could not discover assets", "fiat", fiat, "err", err)
+			continue
+		}
+		d.mu.Lock()
+		d.assets[fiat] = assets
+		d.mu.Unlock()
+		b.logger.Info("discovered assets", "fiat", fiat, "assets", len(assets))
+	}
+	d.mu.Lock()
+	d.refreshed = time.Now()
+	d.mu.Unlock()
+}
+
+func (b *Binance) getTradableAssets(ctx context.Context, fiat string) ([]string, error) {
+	body, err := json.Marshal(models.BinanceConfigRequest{Fiat: fiat})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal a config request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, b.discovery.config.Address, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create a config request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	b.setHeaders(request, b.clients[""])
+	if err = b.wait(ctx); err != nil {
+		return nil, fmt.Errorf("could not wait for the rate limiter: %w", err)
+	}
+
+	response, err := b.clients[""].httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not send a config request: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read a config responce body: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unsuccessfull config request, status code %d", response.StatusCode)
+	}
+
+	var configResponse models.BinanceConfigResponse
+	if err = json.Unmarshal(responseBody, &configResponse); err != nil {
+		return nil, fmt.Errorf("could not unmarshal a config responce body: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var assets []string
+	for _, area := range configResponse.Data.Areas {
+		if area.Area == nil || *area.Area != "P2P" {
+			continue
+		}
+		for _, side := range area.TradeSides {
+			for _, asset := range side.Assets {
+				if asset.Asset == nil || seen[*asset.Asset] {
+					continue
+				}
+				if b.discovery.filter != nil && !b.discovery.filter.MatchString(*asset.Asset) {
+					continue
+				}
+				seen[*asset.Asset] = true
+				assets = append(assets, *asset.Asset)
+			}
+		}
+	}
+	return assets, nil
+}
+
+// assetsFor merges the configured assets with the discovered ones,
+// with discovery enabled the list is capped at maxAssets
+func (b *Binance) assetsFor(fiat string) []string {
+	if b.discovery == nil {
+		return b.config.Assets
+	}
+	d := b.discovery
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	assets := make([]string, 0, len(b.config.Assets)+len(d.assets[fiat]))
+	seen := make(map[string]bool)
+	for _, asset := range append(append([]string{}, b.config.Assets...), d.assets[fiat]...) {
+		if seen[asset] {
+			continue
+		}
+		if len(assets) >= d.config.MaxAssets {
+			b.logger.Debug("assets are capped", "fiat", fiat, "maxAssets", d.config.MaxAssets)
+			break
+		}
+		seen[asset] = true
+		assets = append(assets, asset)
+	}
+	return assets
+}
@@ -0,0 +1,51 @@
+package binance
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+const (
+	endpointSuccess = "success"
+	endpointFailure = "failure"
+)
+
+func init() {
+	prometheus.MustRegister(binanceEndpointRequests)
+}
+
+var binanceEndpointRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "binance",
+		Name:      "endpoint_requests_total",
+		Help:      "Requests sent to a binance endpoint by result, retries included in a single request.",
+	},
+	[]string{"address", "result"},
+)
+
+// endpoint is an address requests are tried at and whether they are signed there
+type endpoint struct {
+	address string
+	sign    bool
+}
+
+// endpoints lists the endpoints requests are tried at in order, the endpoint
+// blocks replace addresses, which replaces address and fallbackAddresses
+func endpoints(cfg configs.Binance) []endpoint {
+	if len(cfg.Endpoints) != 0 {
+		list := make([]endpoint, 0, len(cfg.Endpoints))
+		for _, spec := range cfg.Endpoints {
+			list = append(list, endpoint{address: spec.Address, sign: spec.Sign})
+		}
+		return list
+	}
+	addresses := cfg.Addresses
+	if len(addresses) == 0 {
+		addresses = append([]string{cfg.Address}, cfg.FallbackAddresses...)
+	}
+	list := make([]endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		list = append(list, endpoint{address: address})
+	}
+	return list
+}
@@ -0,0 +1,24 @@
+package binance
+
+const (
+	requestErrorKind = "request"
+	decodeErrorKind  = "decode"
+	// the response was successful but its body carried an error code
+	errorCodeErrorKind = "errorCode"
+)
+
+var errorKinds = []string{requestErrorKind, decodeErrorKind, errorCodeErrorKind}
+
+// fetchError tells at which step fetching binance data failed
+type fetchError struct {
+	kind string
+	err  error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,77 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+var (
+	defaultPriceBuckets            = prometheus.ExponentialBuckets(0.01, 2.5, 20)
+	defaultTradableQuantityBuckets = prometheus.ExponentialBuckets(1, 4, 15)
+	defaultCommissionRateBuckets   = prometheus.LinearBuckets(0, 0.001, 11)
+)
+
+const (
+	// native buckets of a label set, the resolution is halved to stay within them
+	defaultNativeMaxBuckets = 160
+	// native buckets are reset to the full resolution at most this often
+	nativeMinResetDuration = time.Hour
+)
+
+// useHistograms replaces the offer summaries with histograms,
+// a histogram exports a series per bucket for every label set
+// and a native histogram as well when a native bucket factor is set
+func useHistograms(cfg configs.Histograms) error {
+	if cfg.NativeBucketFactor != 0 && cfg.NativeMaxBuckets == 0 {
+		cfg.NativeMaxBuckets = defaultNativeMaxBuckets
+	}
+	var err error
+	binancePrice, err = replaceWithHistogram(binancePrice, binancePriceSummaryOpts, cfg, cfg.PriceBuckets, defaultPriceBuckets)
+	if err != nil {
+		return err
+	}
+	binanceTradableQuantity, err = replaceWithHistogram(binanceTradableQuantity, binanceTradableQuantitySummaryOpts,
+		cfg, cfg.TradableQuantityBuckets, defaultTradableQuantityBuckets)
+	if err != nil {
+		return err
+	}
+	binanceCommissionRate, err = replaceWithHistogram(binanceCommissionRate, binanceCommissionRateSummaryOpts,
+		cfg, cfg.CommissionRateBuckets, defaultCommissionRateBuckets)
+	return err
+}
+
+func replaceWithHistogram(
+	current prometheus.ObserverVec,
+	opts prometheus.SummaryOpts,
+	cfg configs.Histograms,
+	buckets, defaultBuckets []float64,
+) (prometheus.ObserverVec, error) {
+	if len(buckets) == 0 {
+		buckets = defaultBuckets
+	}
+	prometheus.Unregister(current)
+	histogramOpts := prometheus.HistogramOpts{
+		Namespace: opts.Namespace,
+		Name:      opts.Name,
+		Help:      opts.Help,
+		Buckets:   buckets,
+	}
+	if cfg.NativeBucketFactor != 0 {
+		histogramOpts.NativeHistogramBucketFactor = cfg.NativeBucketFactor
+		histogramOpts.NativeHistogramMaxBucketNumber = uint32(cfg.NativeMaxBuckets)
+		histogramOpts.NativeHistogramMinResetDuration = nativeMinResetDuration
+	}
+	histogram := prometheus.NewHistogramVec(histogramOpts, binanceLabels)
+	if err := prometheus.Register(histogram); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return nil, fmt.Errorf("could not register %s_%s histogram: %w", opts.Namespace, opts.Name, err)
+		}
+		return registered.ExistingCollector.(prometheus.ObserverVec), nil
+	}
+	return histogram, nil
+}
@@ -0,0 +1,55 @@
+package binance
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestReplaceWithHistogram(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        configs.Histograms
+		wantNative bool
+	}{
+		{name: "classic buckets", cfg: configs.Histograms{}},
+		{name: "native buckets", cfg: configs.Histograms{NativeBucketFactor: 1.1, NativeMaxBuckets: 16}, wantNative: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := prometheus.SummaryOpts{Namespace: "binance", Name: "histogram_test", Help: "Observations of the test."}
+			summary := prometheus.NewSummaryVec(opts, binanceLabels)
+			prometheus.MustRegister(summary)
+
+			histogram, err := replaceWithHistogram(summary, opts, tt.cfg, nil, []float64{1, 10})
+			if err != nil {
+				t.Fatalf("could not replace the summary: %s", err.Error())
+			}
+			t.Cleanup(func() { prometheus.Unregister(histogram.(prometheus.Collector)) })
+			histogram.WithLabelValues("BUY", "USDT", "RUB", "other", "true", "").Observe(5)
+
+			families, err := prometheus.DefaultGatherer.Gather()
+			if err != nil {
+				t.Fatalf("could not gather: %s", err.Error())
+			}
+			for _, family := range families {
+				if family.GetName() != "binance_histogram_test" {
+					continue
+				}
+				got := family.GetMetric()[0].GetHistogram()
+				if got == nil {
+					t.Fatalf("got a %s, want a histogram", family.GetType())
+				}
+				if len(got.GetBucket()) != 2 {
+					t.Errorf("got %d classic buckets, want 2", len(got.GetBucket()))
+				}
+				if native := got.Schema != nil; native != tt.wantNative {
+					t.Errorf("got a native histogram %v, want %v", native, tt.wantNative)
+				}
+				return
+			}
+			t.Fatalf("binance_histogram_test was not gathered")
+		})
+	}
+}
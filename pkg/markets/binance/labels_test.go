@@ -0,0 +1,76 @@
+package binance
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func TestLabelsFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   models.BinanceRequest
+		want      []string
+		wantPair  []string
+		wantDrops bool
+	}{
+		{
+			name:     "merchant ads of a grouped fiat",
+			options:  models.BinanceRequest{TradeType: buyTradeType, Asset: "USDT", Fiat: "RUB", MerchantCheck: true},
+			want:     []string{buyTradeType, "USDT", "RUB", "cis", "true", ""},
+			wantPair: []string{"USDT", "RUB", "true", ""},
+		},
+		{
+			name:     "every advertiser of an ungrouped fiat",
+			options:  models.BinanceRequest{TradeType: sellTradeType, Asset: "BTC", Fiat: "EUR"},
+			want:     []string{sellTradeType, "BTC", "EUR", defaultCurrencyGroup, "false", ""},
+			wantPair: []string{"BTC", "EUR", "false", ""},
+		},
+		{
+			name: "pay types",
+			options: models.BinanceRequest{
+				TradeType: buyTradeType, Asset: "USDT", Fiat: "RUB", MerchantCheck: true, PayTypes: []string{"Tinkoff", "QIWI"},
+			},
+			want:     []string{buyTradeType, "USDT", "RUB", "cis", "true", "Tinkoff,QIWI"},
+			wantPair: []string{"USDT", "RUB", "true", "Tinkoff,QIWI"},
+		},
+		{
+			name:     "missing fields",
+			options:  models.BinanceRequest{},
+			want:     []string{"", "", "", defaultCurrencyGroup, "false", ""},
+			wantPair: []string{"", "", "false", ""},
+		},
+		{
+			name:      "dropped by a relabel rule",
+			options:   models.BinanceRequest{TradeType: buyTradeType, Asset: "DROPPED", Fiat: "RUB"},
+			wantDrops: true,
+		},
+	}
+	b, err := New(configs.Binance{
+		CurrencyGroups: map[string]string{"RUB": "cis"},
+		Relabels:       []configs.Relabel{{Action: "drop", SourceLabel: "asset", Regex: "DROPPED"}},
+	})
+	if err != nil {
+		t.Fatalf("could not create binance: %s", err.Error())
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, keep := b.labelsFor(&tt.options)
+			pairLabels, pairKeep := b.pairLabelsFor(&tt.options)
+			if tt.wantDrops {
+				if keep || pairKeep {
+					t.Errorf("got labels %v and pair labels %v kept, want them dropped", labels, pairLabels)
+				}
+				return
+			}
+			if !keep || !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("got labels %v kept %v, want %v", labels, keep, tt.want)
+			}
+			if !pairKeep || !reflect.DeepEqual(pairLabels, tt.wantPair) {
+				t.Errorf("got pair labels %v kept %v, want %v", pairLabels, pairKeep, tt.wantPair)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package binance
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// newLimiter returns nil when requestsPerSecond is not set,
+// the burst is at least a single request
+func newLimiter(requestsPerSecond float64, burst int) *rate.Limiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+}
+
+// wait blocks until the limiter allows the next binance request or ctx is done
+func (b *Binance) wait(ctx context.Context) error {
+	if b.limiter == nil {
+		return nil
+	}
+	return b.limiter.Wait(ctx)
+}
@@ -0,0 +1,68 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestLimiterSpacing(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	cfg := configs.Binance{
+		Assets:            []string{"RATEA", "RATEB", "RATEC"},
+		Fiats:             []string{"RUB"},
+		RequestsPerSecond: float64(time.Second / interval),
+		Burst:             1,
+	}
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		options := decodeRequest(t, r)
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	})
+	if err := b.GetAllData(context.Background()); err != nil {
+		t.Fatalf("could not get data: %s", err.Error())
+	}
+
+	if len(times) != 6 {
+		t.Fatalf("got %d requests, want 6", len(times))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	// the concurrent requests are spaced by the limiter, with some slack for the scheduler
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval*8/10 {
+			t.Errorf("request %d came %s after the previous one, want at least %s", i, gap, interval)
+		}
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	b, err := New(configs.Binance{RequestsPerSecond: 0.001, Burst: 1})
+	if err != nil {
+		t.Fatalf("could not create binance: %s", err.Error())
+	}
+	if err = b.wait(context.Background()); err != nil {
+		t.Fatalf("could not take the burst: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	// the limiter refuses to wait past the deadline of the context
+	if err = b.wait(ctx); err == nil {
+		t.Fatalf("got a request allowed beyond the rate")
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("waiting took %s after the context was done", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func TestGetPages(t *testing.T) {
+	// pages of two rows, the second repeats an ad of the first and the third is short
+	pages := map[int32][]string{
+		1: {"a", "b"},
+		2: {"b", "c"},
+		3: {"d"},
+		4: {"e", "f"},
+	}
+	tests := []struct {
+		name            string
+		pageConcurrency int
+		maxInFlight     int32
+		wantRequests    int32
+	}{
+		{name: "serial pages", maxInFlight: 1, wantRequests: 3},
+		{name: "concurrent pages", pageConcurrency: 2, maxInFlight: 2, wantRequests: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				inFlight, peak, requests atomic.Int32
+				mu                       sync.Mutex
+			)
+			cfg := configs.Binance{MaxPages: 4, PageConcurrency: tt.pageConcurrency}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				options := decodeRequest(t, r)
+				requests.Add(1)
+				current := inFlight.Add(1)
+				mu.Lock()
+				if current > peak.Load() {
+					peak.Store(current)
+				}
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				inFlight.Add(-1)
+				var ads []models.Data
+				for _, advNo := range pages[options.Page] {
+					ad := testAd(options.TradeType, options.Asset, options.Fiat, "90")
+					ad.Adv.AdvNo = stringPtr(advNo)
+					ads = append(ads, ad)
+				}
+				writeAds(t, w, ads...)
+			})
+			options := getOptions("PAGES", "RUB", 2, true, nil)[0]
+
+			ads, err := b.getPages(context.Background(), &options)
+			if err != nil {
+				t.Fatalf("could not get the pages: %s", err.Error())
+			}
+			got := make([]string, 0, len(ads))
+			for _, ad := range ads {
+				got = append(got, *ad.Adv.AdvNo)
+			}
+			if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got ads %v, want %v", got, want)
+			}
+			if got := peak.Load(); got != tt.maxInFlight {
+				t.Errorf("got %d pages in flight at once, want %d", got, tt.maxInFlight)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d page requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPageConcurrencyWithinMaxConcurrency(t *testing.T) {
+	b, err := New(configs.Binance{MaxPages: 2, PageConcurrency: 4, MaxConcurrency: 8})
+	if err != nil {
+		t.Fatalf("could not create binance: %s", err.Error())
+	}
+	if b.config.PageConcurrency != 2 {
+		t.Errorf("got a page concurrency of %d, want it cut to the 2 pages", b.config.PageConcurrency)
+	}
+}
@@ -0,0 +1,197 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func TestParseOfferMissingFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(adv *models.Adv)
+		wantErr string
+	}{
+		{name: "every field set", modify: func(adv *models.Adv) {}},
+		{name: "no trade type", modify: func(adv *models.Adv) { adv.TradeType = nil }, wantErr: "the tradeType is missing"},
+		{name: "no asset", modify: func(adv *models.Adv) { adv.Asset = nil }, wantErr: "the asset is missing"},
+		{name: "no fiat", modify: func(adv *models.Adv) { adv.FiatUnit = nil }, wantErr: "the fiatUnit is missing"},
+		{name: "no price", modify: func(adv *models.Adv) { adv.Price = nil }, wantErr: "the price is missing"},
+		{name: "no tradable quantity", modify: func(adv *models.Adv) { adv.TradableQuantity = nil }, wantErr: "the tradableQuantity is missing"},
+		{name: "no commission rate", modify: func(adv *models.Adv) { adv.CommissionRate = nil }, wantErr: "the commissionRate is missing"},
+		{name: "no optional limits", modify: func(adv *models.Adv) {
+			adv.MinSingleTransAmount = nil
+			adv.MaxSingleTransAmount = nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ad := testAd(buyTradeType, "USDT", "RUB", "90")
+			ad.Adv.MinSingleTransAmount = stringPtr("1000")
+			tt.modify(&ad.Adv)
+
+			_, err := parseOffer(ad)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("could not parse: %s", err.Error())
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollectNullFields(t *testing.T) {
+	// the second ad has every field null and the third a null price and advertiser
+	const response = `{"code":"000000","success":true,"data":[
+		{"adv":{"tradeType":"BUY","asset":"NULLS","fiatUnit":"RUB","price":"90","tradableQuantity":"10","commissionRate":"0"},"advertiser":{}},
+		{"adv":{"tradeType":null,"asset":null,"fiatUnit":null,"price":null,"tradableQuantity":null,"commissionRate":null,"tradeMethods":null},"advertiser":null},
+		{"adv":{"tradeType":"BUY","asset":"NULLS","fiatUnit":"RUB","price":null,"tradableQuantity":"10","commissionRate":"0"},"advertiser":null},
+		{"adv":null,"advertiser":null}
+	]}`
+	b := newTestBinance(t, configs.Binance{}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, response)
+	})
+	options := getOptions("NULLS", "RUB", defaultRows, true, nil)[0]
+
+	result, err := b.collect(context.Background(), &options)
+	if err != nil {
+		t.Fatalf("could not collect: %s", err.Error())
+	}
+	if result.adsCount != 4 || len(result.offers) != 1 || result.offers[0].Price != 90 {
+		t.Errorf("got %d ads and offers %v, want 4 ads and the single complete offer", result.adsCount, result.offers)
+	}
+	b.observe(context.Background(), result)
+}
+
+func TestCollectMalformedAd(t *testing.T) {
+	tests := []struct {
+		name      string
+		malformed func(ad *models.Data)
+	}{
+		{name: "malformed price", malformed: func(ad *models.Data) { ad.Adv.Price = stringPtr("ninety") }},
+		{name: "malformed tradable quantity", malformed: func(ad *models.Data) { ad.Adv.TradableQuantity = stringPtr("") }},
+		{name: "malformed commission rate", malformed: func(ad *models.Data) { ad.Adv.CommissionRate = stringPtr("1,5") }},
+		{name: "malformed limit", malformed: func(ad *models.Data) { ad.Adv.MaxSingleTransAmount = stringPtr("lots") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			malformed := testAd(buyTradeType, "MIXED", "RUB", "91")
+			tt.malformed(&malformed)
+			b := newTestBinance(t, configs.Binance{}, func(w http.ResponseWriter, r *http.Request) {
+				writeAds(t, w,
+					testAd(buyTradeType, "MIXED", "RUB", "90"),
+					malformed,
+					testAd(buyTradeType, "MIXED", "RUB", "92"),
+				)
+			})
+			options := getOptions("MIXED", "RUB", defaultRows, true, nil)[0]
+
+			result, err := b.collect(context.Background(), &options)
+			if err != nil {
+				t.Fatalf("could not collect: %s", err.Error())
+			}
+			if got := offerPrices(result.offers); len(got) != 2 || got[0] != 90 || got[1] != 92 {
+				t.Errorf("got prices %v, want the valid ads around the malformed one", got)
+			}
+		})
+	}
+}
+
+func TestParseOfferFieldError(t *testing.T) {
+	ad := testAd(buyTradeType, "USDT", "RUB", "90")
+	ad.Adv.CommissionRate = stringPtr("1,5")
+	_, err := parseOffer(ad)
+	if err == nil || !strings.Contains(err.Error(), `could not parse the commissionRate "1,5"`) {
+		t.Errorf("got error %v, want the commissionRate and its raw value named", err)
+	}
+}
+
+func TestObserveAdvertiserStats(t *testing.T) {
+	zeroRate, orders := 0.0, 0
+	withStats := testAd(buyTradeType, "STATS", "RUB", "90")
+	withStats.Advertiser = models.Advertiser{MonthOrderCount: &orders, MonthFinishRate: &zeroRate}
+	withoutStats := testAd(buyTradeType, "STATS", "RUB", "91")
+	b := newTestBinance(t, configs.Binance{}, func(w http.ResponseWriter, r *http.Request) {
+		writeAds(t, w, withStats, withoutStats)
+	})
+	options := getOptions("STATS", "RUB", defaultRows, true, nil)[0]
+	labels, _ := b.labelsFor(&options)
+
+	result, err := b.collect(context.Background(), &options)
+	if err != nil {
+		t.Fatalf("could not collect: %s", err.Error())
+	}
+	b.observe(context.Background(), result)
+
+	// the ad without stats is not observed as a zero
+	if count, sum := observations(t, binanceAdvertiserMonthFinishRate, labels...); count != 1 || sum != 0 {
+		t.Errorf("got %d finish rates summing to %v, want the single zero rate", count, sum)
+	}
+	if count, sum := observations(t, binanceAdvertiserMonthOrderCount, labels...); count != 1 || sum != 0 {
+		t.Errorf("got %d order counts summing to %v, want the single zero count", count, sum)
+	}
+	if count, _ := observations(t, binancePrice, labels...); count != 2 {
+		t.Errorf("got %d prices, want both ads observed", count)
+	}
+}
+
+func TestCollectErrorPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  string
+	}{
+		{
+			name:     "error code with a message",
+			response: `{"code":"000002","message":"illegal parameter","messageDetail":"rows","data":null,"success":false}`,
+			wantErr:  `binance responded with error code "000002": illegal parameter: rows`,
+		},
+		{
+			name:     "error code without a message",
+			response: `{"code":"100001","data":[],"success":false}`,
+			wantErr:  `binance responded with error code "100001"`,
+		},
+		{
+			name:     "success false with the success code",
+			response: `{"code":"000000","message":"busy","data":[],"success":false}`,
+			wantErr:  `binance responded with error code "000000": busy`,
+		},
+		{
+			name:     "no wrapper fields",
+			response: `{"data":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBinance(t, configs.Binance{}, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tt.response)
+			})
+			options := getOptions("PAYLOAD", "RUB", defaultRows, true, nil)[0]
+
+			_, err := b.collect(context.Background(), &options)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("could not collect: %s", err.Error())
+				}
+				return
+			}
+			var fetchErr *fetchError
+			if !errors.As(err, &fetchErr) || fetchErr.kind != errorCodeErrorKind {
+				t.Fatalf("got error %v, want a %s fetch error", err, errorCodeErrorKind)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
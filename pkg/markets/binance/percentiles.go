@@ -0,0 +1,72 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+// percentileGauge is a per-scrape price percentile, unlike the summary
+// quantiles it only covers the offers of a single request
+type percentileGauge struct {
+	percentile float64
+	gauge      *prometheus.GaugeVec
+}
+
+// newPercentileGauges registers a binance_price_pNN gauge for every percentile
+func newPercentileGauges(percentiles []float64) ([]percentileGauge, error) {
+	gauges := make([]percentileGauge, 0, len(percentiles))
+	for _, percentile := range percentiles {
+		if percentile <= 0 || percentile > 100 {
+			return nil, fmt.Errorf("percentile %v is out of (0, 100]", percentile)
+		}
+		name := strings.ReplaceAll(strconv.FormatFloat(percentile, 'f', -1, 64), ".", "_")
+		gauge := prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "binance",
+				Name:      "price_p" + name,
+				Help:      "Price percentile of the offers, in fiat per asset unit.",
+			},
+			binanceLabels,
+		)
+		if err := prometheus.Register(gauge); err != nil {
+			var registered prometheus.AlreadyRegisteredError
+			if !errors.As(err, &registered) {
+				return nil, fmt.Errorf("could not register percentile %v gauge: %w", percentile, err)
+			}
+			gauge = registered.ExistingCollector.(*prometheus.GaugeVec)
+		}
+		gauges = append(gauges, percentileGauge{percentile: percentile, gauge: gauge})
+	}
+	return gauges, nil
+}
+
+// pricePercentile interpolates the percentile between the closest ranks
+// of ascending prices
+func pricePercentile(prices []float64, percentile float64) float64 {
+	rank := percentile / 100 * float64(len(prices)-1)
+	lower := int(rank)
+	if lower+1 >= len(prices) {
+		return prices[len(prices)-1]
+	}
+	return prices[lower] + (rank-float64(lower))*(prices[lower+1]-prices[lower])
+}
+
+func (b *Binance) observePercentiles(labels []string, offers []models.Offer) {
+	if len(b.percentiles) == 0 {
+		return
+	}
+	prices := make([]float64, 0, len(offers))
+	for _, offer := range offers {
+		prices = append(prices, offer.Price)
+	}
+	sort.Float64s(prices)
+	for _, percentile := range b.percentiles {
+		percentile.gauge.WithLabelValues(labels...).Set(pricePercentile(prices, percentile.percentile))
+	}
+}
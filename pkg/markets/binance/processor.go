@@ -0,0 +1,34 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+// OfferProcessor runs custom logic over the parsed offers of every request
+type OfferProcessor interface {
+	Process(ctx context.Context, offers []models.Offer)
+}
+
+// offerProcessors runs every registered processor, none is a no-op
+type offerProcessors []OfferProcessor
+
+// run hands every processor its own copy of the offers
+func (p offerProcessors) run(ctx context.Context, logger *slog.Logger, offers []models.Offer) {
+	for _, processor := range p {
+		runProcessor(ctx, logger, processor, append([]models.Offer(nil), offers...))
+	}
+}
+
+// runProcessor keeps a panicking processor from breaking the scrape
+func runProcessor(ctx context.Context, logger *slog.Logger, processor OfferProcessor, offers []models.Offer) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("offer processor panicked", "processor", fmt.Sprintf("%T", processor), "panic", r)
+		}
+	}()
+	processor.Process(ctx, offers)
+}
@@ -0,0 +1,89 @@
+package binance
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+// reversingProcessor reverses the offers it is handed and keeps them
+type reversingProcessor struct {
+	offers []models.Offer
+}
+
+func (p *reversingProcessor) Process(ctx context.Context, offers []models.Offer) {
+	for i, j := 0, len(offers)-1; i < j; i, j = i+1, j-1 {
+		offers[i], offers[j] = offers[j], offers[i]
+	}
+	p.offers = offers
+}
+
+type panickingProcessor struct{}
+
+func (panickingProcessor) Process(ctx context.Context, offers []models.Offer) {
+	panic("scoring failed")
+}
+
+func testOffers(prices ...float64) []models.Offer {
+	offers := make([]models.Offer, 0, len(prices))
+	for _, price := range prices {
+		offers = append(offers, models.Offer{Price: price})
+	}
+	return offers
+}
+
+func offerPrices(offers []models.Offer) []float64 {
+	prices := make([]float64, 0, len(offers))
+	for _, offer := range offers {
+		prices = append(prices, offer.Price)
+	}
+	return prices
+}
+
+func TestOfferProcessorsRun(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil)).With("source", "binance")
+	first, last := &reversingProcessor{}, &reversingProcessor{}
+	processors := offerProcessors{first, panickingProcessor{}, last}
+	offers := testOffers(1, 2, 3)
+
+	processors.run(context.Background(), logger, offers)
+	if got := offerPrices(offers); got[0] != 1 || got[2] != 3 {
+		t.Errorf("a processor reordered the scraped offers to %v", got)
+	}
+	if got := offerPrices(last.offers); got[0] != 3 || got[2] != 1 {
+		t.Errorf("the last processor got %v reversed, want [3 2 1]", got)
+	}
+	if !strings.Contains(logs.String(), "offer processor panicked") || !strings.Contains(logs.String(), "source=binance") {
+		t.Errorf("the panic is not logged through the given logger: %q", logs.String())
+	}
+}
+
+func TestSortedByBest(t *testing.T) {
+	tests := []struct {
+		name      string
+		tradeType string
+		want      []float64
+	}{
+		{name: "buy", tradeType: buyTradeType, want: []float64{1, 2, 3}},
+		{name: "sell", tradeType: sellTradeType, want: []float64{3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offers := testOffers(2, 3, 1)
+			got := offerPrices(sortedByBest(offers, tt.tradeType))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if prices := offerPrices(offers); prices[0] != 2 || prices[1] != 3 || prices[2] != 1 {
+				t.Errorf("the offers were sorted in place to %v", prices)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package binance
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	prometheus.MustRegister(binanceQueueWait)
+}
+
+var binanceQueueWait = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Namespace: "binance",
+		Name:      "queue_wait_seconds",
+		Help:      "Time a request waited for one of the maxConcurrency slots, in seconds.",
+		Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+)
+
+// queued observes the time from now until the request starts running,
+// which is when the errgroup it is passed to grants it a slot
+func queued(request func() error) func() error {
+	readyAt := time.Now()
+	return func() error {
+		binanceQueueWait.Observe(time.Since(readyAt).Seconds())
+		return request()
+	}
+}
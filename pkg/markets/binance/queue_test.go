@@ -0,0 +1,107 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+// queueWait returns the number and the sum of the queue wait observations
+func queueWait(t *testing.T) (uint64, float64) {
+	t.Helper()
+	var written dto.Metric
+	if err := binanceQueueWait.Write(&written); err != nil {
+		t.Fatalf("could not write a metric: %s", err.Error())
+	}
+	return written.Histogram.GetSampleCount(), written.Histogram.GetSampleSum()
+}
+
+func TestQueueWait(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	cfg := configs.Binance{Assets: []string{"QUEUEA", "QUEUEB"}, Fiats: []string{"RUB"}, MaxConcurrency: 1}
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		options := decodeRequest(t, r)
+		time.Sleep(delay)
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	})
+
+	countBefore, sumBefore := queueWait(t)
+	if err := b.GetAllData(context.Background()); err != nil {
+		t.Fatalf("could not get data: %s", err.Error())
+	}
+	count, sum := queueWait(t)
+	// the fan-out blocks on every request waiting for a slot, so each of
+	// the last three serial requests waits for the one before it
+	if got := count - countBefore; got != 4 {
+		t.Errorf("got %d queue wait observations, want 4", got)
+	}
+	if got, want := sum-sumBefore, (3 * delay).Seconds(); got < want {
+		t.Errorf("got a queue wait of %vs, want at least %vs", got, want)
+	}
+}
+
+// countingTransport answers every request with a single ad after a delay
+// and records the most requests it had in flight at once
+type countingTransport struct {
+	t        *testing.T
+	delay    time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	current := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if current <= peak || c.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+
+	options := decodeRequest(c.t, r)
+	recorder := httptest.NewRecorder()
+	writeAds(c.t, recorder, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	return recorder.Result(), nil
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		want           int32
+	}{
+		{name: "serial", maxConcurrency: 1, want: 1},
+		{name: "capped", maxConcurrency: 3, want: 3},
+		{name: "default", want: defaultMaxConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// twelve sides are more than any of the caps
+			cfg := configs.Binance{
+				Assets:         []string{"CAPA", "CAPB", "CAPC"},
+				Fiats:          []string{"RUB", "KZT"},
+				MaxConcurrency: tt.maxConcurrency,
+			}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("a request went around the transport")
+			})
+			transport := &countingTransport{t: t, delay: 30 * time.Millisecond}
+			b.UseTransport(transport)
+
+			if err := b.GetAllData(context.Background()); err != nil {
+				t.Fatalf("could not get data: %s", err.Error())
+			}
+			if got := transport.peak.Load(); got != tt.want {
+				t.Errorf("got %d requests in flight at once, want %d", got, tt.want)
+			}
+		})
+	}
+}
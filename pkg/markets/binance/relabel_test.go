@@ -0,0 +1,58 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestRelabelPairMetrics(t *testing.T) {
+	prices := map[string]string{buyTradeType: "90", sellTradeType: "94"}
+	cfg := configs.Binance{
+		Assets:         []string{"RELKEEP", "RELDROP"},
+		Fiats:          []string{"BIF"},
+		MidPrice:       true,
+		Spread:         true,
+		DetectTwoSided: true,
+		StaleOnFailure: true,
+		Relabels: []configs.Relabel{
+			{Action: "replace", SourceLabel: "fiat", Regex: "BIF|KMF", TargetLabel: "fiat", Replacement: "other"},
+			{Action: "drop", SourceLabel: "asset", Regex: "RELDROP"},
+		},
+	}
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		options := decodeRequest(t, r)
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, prices[options.TradeType]))
+	})
+	if err := b.GetAllData(context.Background()); err != nil {
+		t.Fatalf("could not get data: %s", err.Error())
+	}
+
+	kept := []string{"RELKEEP", "other", "true", ""}
+	if got := testutil.ToFloat64(binanceMidPrice.WithLabelValues(kept...)); got != 92 {
+		t.Errorf("got a relabeled mid price of %v, want 92", got)
+	}
+	if got := testutil.ToFloat64(binanceSpread.WithLabelValues(kept...)); got != 4 {
+		t.Errorf("got a relabeled spread of %v, want 4", got)
+	}
+	if !binanceTwoSidedAdvertisers.DeleteLabelValues(kept...) {
+		t.Errorf("the two-sided advertiser count is not relabeled")
+	}
+	if !binanceLastPrice.DeleteLabelValues(buyTradeType, "RELKEEP", "other", defaultCurrencyGroup, "true", "", "false") {
+		t.Errorf("the last price is not relabeled")
+	}
+
+	for _, labels := range [][]string{
+		{"RELKEEP", "BIF", "true", ""},
+		{"RELDROP", "other", "true", ""},
+		{"RELDROP", "BIF", "true", ""},
+	} {
+		if binanceMidPrice.DeleteLabelValues(labels...) || binanceSpread.DeleteLabelValues(labels...) ||
+			binanceTwoSidedAdvertisers.DeleteLabelValues(labels...) {
+			t.Errorf("a pair metric is exported with the labels %v", labels)
+		}
+	}
+}
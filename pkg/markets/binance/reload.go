@@ -0,0 +1,85 @@
+package binance
+
+import (
+	"fmt"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+// watchlist is what a reload swaps: the scraped assets, fiats and pairs
+type watchlist struct {
+	assets []string
+	fiats  []string
+	pairs  []configs.Pair
+}
+
+// Reload schedules the assets, fiats and pairs of cfg to be scraped from
+// the next scrape on, a scrape in flight keeps the current ones
+func (b *Binance) Reload(cfg configs.Binance) error {
+	for _, pair := range cfg.Pairs {
+		if _, ok := b.clients[pair.Client]; !ok {
+			return fmt.Errorf("pair %s/%s references unknown client %s", pair.Asset, pair.Fiat, pair.Client)
+		}
+	}
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+	b.reloaded = &watchlist{assets: cfg.Assets, fiats: cfg.Fiats, pairs: cfg.Pairs}
+	return nil
+}
+
+// applyReload swaps in the scheduled watchlist, it is called before
+// a scrape starts so no request of a scrape sees two different lists
+func (b *Binance) applyReload() {
+	b.reloadMu.Lock()
+	reloaded := b.reloaded
+	b.reloaded = nil
+	b.reloadMu.Unlock()
+	if reloaded == nil {
+		return
+	}
+
+	logDiff := func(name string, previous, current []string) {
+		added, removed := diff(previous, current)
+		if len(added) != 0 || len(removed) != 0 {
+			b.logger.Info("watchlist reloaded", "list", name, "added", added, "removed", removed)
+		}
+	}
+	logDiff("assets", b.config.Assets, reloaded.assets)
+	logDiff("fiats", b.config.Fiats, reloaded.fiats)
+	logDiff("pairs", pairNames(b.config.Pairs), pairNames(reloaded.pairs))
+
+	b.config.Assets = reloaded.assets
+	b.config.Fiats = reloaded.fiats
+	b.config.Pairs = reloaded.pairs
+}
+
+// pairNames describes the pair overrides so a changed override shows up in the diff
+func pairNames(pairs []configs.Pair) []string {
+	names := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		names = append(names, fmt.Sprintf("%s rows=%d priority=%d client=%s",
+			pairKey(pair.Asset, pair.Fiat), pair.Rows, pair.Priority, pair.Client))
+	}
+	return names
+}
+
+// diff returns the items of current missing from previous and the other way around
+func diff(previous, current []string) (added, removed []string) {
+	inPrevious := make(map[string]bool, len(previous))
+	for _, item := range previous {
+		inPrevious[item] = true
+	}
+	inCurrent := make(map[string]bool, len(current))
+	for _, item := range current {
+		inCurrent[item] = true
+		if !inPrevious[item] {
+			added = append(added, item)
+		}
+	}
+	for _, item := range previous {
+		if !inCurrent[item] {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,86 @@
+package binance
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+// binance answers at most this many ads per page
+const maxPageRows = configs.MaxBinanceRows
+
+func init() {
+	prometheus.MustRegister(binanceRows)
+}
+
+var binanceRows = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "rows",
+		Help:      "Ads requested per page for pairs without a rows override.",
+	},
+)
+
+// rowsController shrinks the requested rows while cycles run over the budget
+// and grows them back while cycles take less than half of it
+type rowsController struct {
+	min, max int32
+	budget   time.Duration
+
+	mu   sync.Mutex
+	rows int32
+}
+
+// newRowsController returns nil when adaptive rows are not configured
+func newRowsController(cfg *configs.AdaptiveRows, rows int32) *rowsController {
+	if cfg == nil {
+		binanceRows.Set(float64(rows))
+		return nil
+	}
+	max := cfg.MaxRows
+	if max == 0 {
+		max = maxPageRows
+	}
+	c := &rowsController{
+		min:    cfg.MinRows,
+		max:    max,
+		budget: time.Duration(cfg.BudgetInSeconds) * time.Second,
+		rows:   rows,
+	}
+	c.clamp()
+	binanceRows.Set(float64(c.rows))
+	return c
+}
+
+func (c *rowsController) current() int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rows
+}
+
+func (c *rowsController) observe(cycle time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case cycle > c.budget:
+		c.rows = c.rows * 3 / 4
+	case cycle < c.budget/2:
+		c.rows = c.rows*5/4 + 1
+	}
+	c.clamp()
+	binanceRows.Set(float64(c.rows))
+}
+
+func (c *rowsController) clamp() {
+	if c.rows < c.min {
+		c.rows = c.min
+	}
+	if c.rows > c.max {
+		c.rows = c.max
+	}
+}
@@ -0,0 +1,65 @@
+package binance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestRowsControllerObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    configs.AdaptiveRows
+		rows   int32
+		cycles []time.Duration
+		want   int32
+	}{
+		{
+			name:   "shrinks over the budget",
+			cfg:    configs.AdaptiveRows{MinRows: 5, MaxRows: 20, BudgetInSeconds: 10},
+			rows:   20,
+			cycles: []time.Duration{time.Minute},
+			want:   15,
+		},
+		{
+			name:   "stops at minRows",
+			cfg:    configs.AdaptiveRows{MinRows: 5, MaxRows: 20, BudgetInSeconds: 10},
+			rows:   20,
+			cycles: []time.Duration{time.Minute, time.Minute, time.Minute, time.Minute, time.Minute, time.Minute},
+			want:   5,
+		},
+		{
+			name:   "keeps rows within the budget",
+			cfg:    configs.AdaptiveRows{MinRows: 5, MaxRows: 20, BudgetInSeconds: 10},
+			rows:   10,
+			cycles: []time.Duration{7 * time.Second},
+			want:   10,
+		},
+		{
+			name:   "grows up to maxRows",
+			cfg:    configs.AdaptiveRows{MinRows: 5, MaxRows: 12, BudgetInSeconds: 10},
+			rows:   10,
+			cycles: []time.Duration{time.Second, time.Second},
+			want:   12,
+		},
+		{
+			name:   "grows up to the page cap without maxRows",
+			cfg:    configs.AdaptiveRows{MinRows: 5, BudgetInSeconds: 10},
+			rows:   10,
+			cycles: []time.Duration{time.Second, time.Second, time.Second, time.Second, time.Second},
+			want:   maxPageRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRowsController(&tt.cfg, tt.rows)
+			for _, cycle := range tt.cycles {
+				c.observe(cycle)
+			}
+			if got := c.current(); got != tt.want {
+				t.Errorf("got %d rows, want %d", got, tt.want)
+			}
+		})
+	}
+}
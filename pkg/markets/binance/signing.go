@@ -0,0 +1,31 @@
+package binance
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const apiKeyHeader = "X-MBX-APIKEY"
+
+// sign adds the timestamp, moved by the offset to the server time, the
+// recvWindow and the HMAC-SHA256 signature of the query and the body to the
+// query of the request and the api key to its headers
+func (b *Binance) sign(request *http.Request, body []byte) {
+	query := request.URL.Query()
+	query.Set("timestamp", strconv.FormatInt(b.clock.now().UnixMilli(), 10))
+	if b.config.RecvWindowInSeconds != 0 {
+		recvWindow := time.Duration(b.config.RecvWindowInSeconds) * time.Second
+		query.Set("recvWindow", strconv.FormatInt(recvWindow.Milliseconds(), 10))
+	}
+	payload := query.Encode()
+
+	mac := hmac.New(sha256.New, []byte(b.config.ApiSecret))
+	mac.Write([]byte(payload))
+	mac.Write(body)
+	request.URL.RawQuery = payload + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+	request.Header.Set(apiKeyHeader, b.config.ApiKey)
+}
@@ -0,0 +1,191 @@
+package binance
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slvic/stock-observer/internal/configs"
+)
+
+func TestSignedEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		sign bool
+	}{
+		{name: "signed endpoint", sign: true},
+		{name: "unsigned endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests []*http.Request
+				bodies   [][]byte
+			)
+			cfg := configs.Binance{ApiKey: "key", ApiSecret: "secret"}
+			b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("could not read a request: %s", err.Error())
+				}
+				mu.Lock()
+				requests = append(requests, r)
+				bodies = append(bodies, body)
+				mu.Unlock()
+				writeAds(t, w)
+			})
+			b.endpoints = []endpoint{{address: b.endpoints[0].address, sign: tt.sign}}
+			options := getOptions("SIGNED", "RUB", defaultRows, true, nil)[0]
+			if _, err := b.collect(context.Background(), &options); err != nil {
+				t.Fatalf("could not collect: %s", err.Error())
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			request, body := requests[0], bodies[0]
+			query := request.URL.Query()
+			if !tt.sign {
+				if request.URL.RawQuery != "" || request.Header.Get(apiKeyHeader) != "" {
+					t.Errorf("got query %q and api key %q, want neither", request.URL.RawQuery, request.Header.Get(apiKeyHeader))
+				}
+				return
+			}
+			if got := request.Header.Get(apiKeyHeader); got != "key" {
+				t.Errorf("got api key %q, want %q", got, "key")
+			}
+			if query.Get("timestamp") == "" {
+				t.Errorf("got no timestamp in query %q", request.URL.RawQuery)
+			}
+			payload, signature, found := strings.Cut(request.URL.RawQuery, "&signature=")
+			if !found {
+				t.Fatalf("got no signature in query %q", request.URL.RawQuery)
+			}
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(payload))
+			mac.Write(body)
+			if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+				t.Errorf("got signature %s, want %s", signature, want)
+			}
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  configs.Binance
+		want []endpoint
+	}{
+		{
+			name: "address and fallbacks",
+			cfg:  configs.Binance{Address: "https://a", FallbackAddresses: []string{"https://b"}},
+			want: []endpoint{{address: "https://a"}, {address: "https://b"}},
+		},
+		{
+			name: "addresses",
+			cfg:  configs.Binance{Address: "https://a", Addresses: []string{"https://c"}},
+			want: []endpoint{{address: "https://c"}},
+		},
+		{
+			name: "endpoint blocks",
+			cfg: configs.Binance{
+				Addresses: []string{"https://c"},
+				Endpoints: []configs.Endpoint{{Address: "https://d", Sign: true}, {Address: "https://e"}},
+			},
+			want: []endpoint{{address: "https://d", sign: true}, {address: "https://e"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := endpoints(tt.cfg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got endpoints %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("endpoint %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClockSync(t *testing.T) {
+	const skew = time.Hour
+	var (
+		mu          sync.Mutex
+		timestamps  []int64
+		recvWindows []string
+		timeQueries atomic.Int32
+		timeStatus  atomic.Int32
+	)
+	timeStatus.Store(http.StatusServiceUnavailable)
+	cfg := configs.Binance{Assets: []string{"SKEWED"}, Fiats: []string{"RUB"}, ApiKey: "key", ApiSecret: "secret", RecvWindowInSeconds: 5}
+	b := newTestBinance(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/time" {
+			timeQueries.Add(1)
+			if status := int(timeStatus.Load()); status != http.StatusOK {
+				http.Error(w, "unavailable", status)
+				return
+			}
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().Add(skew).UnixMilli())
+			return
+		}
+		options := decodeRequest(t, r)
+		timestamp, err := strconv.ParseInt(r.URL.Query().Get("timestamp"), 10, 64)
+		if err != nil {
+			t.Errorf("could not parse the timestamp of %q: %s", r.URL.RawQuery, err.Error())
+		}
+		mu.Lock()
+		timestamps = append(timestamps, timestamp)
+		recvWindows = append(recvWindows, r.URL.Query().Get("recvWindow"))
+		mu.Unlock()
+		writeAds(t, w, testAd(options.TradeType, options.Asset, options.Fiat, "90"))
+	})
+	b.endpoints[0].sign = true
+	b.config.ServerTimeAddress = b.endpoints[0].address + "/time"
+
+	// a failed sync keeps the local time and is tried again next cycle
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK} {
+		timeStatus.Store(int32(status))
+		mu.Lock()
+		timestamps, recvWindows = nil, nil
+		mu.Unlock()
+		startTime := time.Now()
+		if err := b.GetAllData(context.Background()); err != nil {
+			t.Fatalf("could not get data: %s", err.Error())
+		}
+
+		wantTime := startTime
+		if status == http.StatusOK {
+			wantTime = startTime.Add(skew)
+		}
+		for i, timestamp := range timestamps {
+			if got := time.UnixMilli(timestamp).Sub(wantTime); got < -time.Second || got > 5*time.Second {
+				t.Errorf("got a timestamp %s off the expected time", got)
+			}
+			if recvWindows[i] != "5000" {
+				t.Errorf("got recvWindow %q, want %q", recvWindows[i], "5000")
+			}
+		}
+	}
+	if got := timeQueries.Load(); got != 2 {
+		t.Errorf("got %d server time requests, want a failed and a successful one", got)
+	}
+	if got := testutil.ToFloat64(binanceClockSkew); got < (skew-time.Second).Seconds() || got > (skew+time.Second).Seconds() {
+		t.Errorf("got a clock skew of %vs, want about %vs", got, skew.Seconds())
+	}
+}
@@ -0,0 +1,119 @@
+package binance
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+// Observation is the latest scrape of a side of a pair
+type Observation struct {
+	TradeType string    `json:"tradeType"`
+	Merchant  bool      `json:"merchant"`
+	PayType   string    `json:"payType,omitempty"`
+	BestPrice float64   `json:"bestPrice"`
+	Offers    int       `json:"offers"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Snapshot holds the latest observations of every side of a pair
+type Snapshot struct {
+	Asset        string        `json:"asset"`
+	Fiat         string        `json:"fiat"`
+	Observations []Observation `json:"observations"`
+}
+
+// snapshots keeps the latest published observation of every side by pair
+type snapshots struct {
+	mu    sync.RWMutex
+	pairs map[string]map[string]Observation
+}
+
+func newSnapshots() *snapshots {
+	return &snapshots{pairs: make(map[string]map[string]Observation)}
+}
+
+func (s *snapshots) update(options *models.BinanceRequest, offers []models.Offer) {
+	if len(offers) == 0 {
+		return
+	}
+	observation := Observation{
+		TradeType: options.TradeType,
+		Merchant:  options.MerchantCheck,
+		PayType:   payTypeLabel(options),
+		BestPrice: bestPrice(offers, options.TradeType),
+		Offers:    len(offers),
+		UpdatedAt: time.Now(),
+	}
+
+	key := pairKey(options.Asset, options.Fiat)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pairs[key] == nil {
+		s.pairs[key] = make(map[string]Observation)
+	}
+	s.pairs[key][marketKey(options)] = observation
+}
+
+func (s *snapshots) get(asset, fiat string) (Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	observations, ok := s.pairs[pairKey(asset, fiat)]
+	if !ok {
+		return Snapshot{}, false
+	}
+	snapshot := Snapshot{
+		Asset:        asset,
+		Fiat:         fiat,
+		Observations: make([]Observation, 0, len(observations)),
+	}
+	for _, observation := range observations {
+		snapshot.Observations = append(snapshot.Observations, observation)
+	}
+	sort.Slice(snapshot.Observations, func(i, j int) bool {
+		a, b := snapshot.Observations[i], snapshot.Observations[j]
+		if a.TradeType != b.TradeType {
+			return a.TradeType < b.TradeType
+		}
+		if a.Merchant != b.Merchant {
+			return a.Merchant
+		}
+		return a.PayType < b.PayType
+	})
+	return snapshot, true
+}
+
+// Snapshot returns the latest observations of the pair,
+// ok is false for pairs that have not been scraped yet
+func (b *Binance) Snapshot(asset, fiat string) (Snapshot, bool) {
+	return b.snapshots.get(asset, fiat)
+}
+
+// Snapshots returns the latest observations of every scraped pair ordered by pair
+func (b *Binance) Snapshots() []Snapshot {
+	b.snapshots.mu.RLock()
+	keys := make([]string, 0, len(b.snapshots.pairs))
+	for key := range b.snapshots.pairs {
+		keys = append(keys, key)
+	}
+	b.snapshots.mu.RUnlock()
+	sort.Strings(keys)
+
+	snapshots := make([]Snapshot, 0, len(keys))
+	for _, key := range keys {
+		asset, fiat, _ := strings.Cut(key, "/")
+		if snapshot, ok := b.snapshots.get(asset, fiat); ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// Pairs returns the asset/fiat pairs of the current watchlist
+func (b *Binance) Pairs() []configs.Pair {
+	return b.scheduledPairs()
+}
@@ -0,0 +1,82 @@
+package binance
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func init() {
+	prometheus.MustRegister(binanceLastPrice)
+}
+
+// binanceLastPrice is the best price of the last successful scrape, while a
+// side keeps failing its last known value is exported with stale="true" instead
+var binanceLastPrice = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "last_price",
+		Help:      "Best price of the last successful scrape, in fiat per asset unit.",
+	},
+	withLabels("stale"),
+)
+
+type lastPrice struct {
+	labels []string
+	price  float64
+}
+
+// standby remembers the last best price of every side to re-emit it
+// as stale during an upstream outage
+type standby struct {
+	enabled bool
+
+	mu     sync.Mutex
+	prices map[string]lastPrice
+}
+
+func newStandby(enabled bool) *standby {
+	return &standby{
+		enabled: enabled,
+		prices:  make(map[string]lastPrice),
+	}
+}
+
+func (s *standby) update(options *models.BinanceRequest, labels []string, offers []models.Offer) {
+	if !s.enabled || len(offers) == 0 {
+		return
+	}
+	price := bestPrice(offers, options.TradeType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[marketKey(options)] = lastPrice{labels: labels, price: price}
+	binanceLastPrice.DeleteLabelValues(append(labels, "true")...)
+	binanceLastPrice.WithLabelValues(append(labels, "false")...).Set(price)
+}
+
+func (s *standby) reemit(options *models.BinanceRequest) {
+	if !s.enabled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.prices[marketKey(options)]
+	if !ok {
+		return
+	}
+	binanceLastPrice.DeleteLabelValues(append(last.labels, "false")...)
+	binanceLastPrice.WithLabelValues(append(last.labels, "true")...).Set(last.price)
+}
+
+func bestPrice(offers []models.Offer, tradeType string) float64 {
+	best := offers[0].Price
+	for _, offer := range offers[1:] {
+		if (tradeType == sellTradeType && offer.Price > best) ||
+			(tradeType != sellTradeType && offer.Price < best) {
+			best = offer.Price
+		}
+	}
+	return best
+}
@@ -0,0 +1,62 @@
+package binance
+
+import (
+	"context"
+	"time"
+
+	"github.com/slvic/stock-observer/internal/storage"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+// UseStorage persists the offers of every scrape into the store
+func (b *Binance) UseStorage(store *storage.Store) {
+	b.store = store
+}
+
+// batchOffers keeps the offers until a batch of the store is gathered
+// and writes the batch then, the rest is written when the scrape is over
+func (b *Binance) batchOffers(ctx context.Context, offers []models.Offer) {
+	if b.store == nil {
+		return
+	}
+	now := time.Now()
+	b.storeMu.Lock()
+	for _, offer := range offers {
+		b.stored = append(b.stored, models.OfferSample{Time: now, Offer: offer})
+	}
+	var batch []models.OfferSample
+	if len(b.stored) >= b.store.BatchSize() {
+		batch = b.stored
+		b.stored = nil
+	}
+	b.storeMu.Unlock()
+
+	b.writeOffers(ctx, batch)
+}
+
+// storeTimeout bounds storing a batch of offers, the scrape context
+// may be done already when they are stored
+const storeTimeout = 10 * time.Second
+
+// storeOffers writes the offers left at the end of the scrape
+func (b *Binance) storeOffers(ctx context.Context) {
+	b.storeMu.Lock()
+	samples := b.stored
+	b.stored = nil
+	b.storeMu.Unlock()
+
+	b.writeOffers(ctx, samples)
+}
+
+// writeOffers stores the samples, a cancelled or timed out scrape context
+// does not keep the gathered offers from being stored
+func (b *Binance) writeOffers(ctx context.Context, samples []models.OfferSample) {
+	if len(samples) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := b.store.WriteOffers(ctx, samples); err != nil {
+		b.logger.Error("could not store offers", "offers", len(samples), "err", err)
+	}
+}
@@ -0,0 +1,60 @@
+package binance
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/internal/storage"
+)
+
+func TestBatchOffers(t *testing.T) {
+	tests := []struct {
+		name       string
+		batchSize  int
+		offers     []int
+		wantStored int
+		wantKept   int
+	}{
+		{name: "below a batch", batchSize: 10, offers: []int{3, 3}, wantStored: 0, wantKept: 6},
+		{name: "a batch is written", batchSize: 4, offers: []int{3, 3}, wantStored: 6, wantKept: 0},
+		{name: "the rest is kept", batchSize: 4, offers: []int{3, 3, 2}, wantStored: 6, wantKept: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := filepath.Join(t.TempDir(), "observer.db")
+			store, err := storage.Open(context.Background(), dsn, tt.batchSize)
+			if err != nil {
+				t.Fatalf("could not open storage: %s", err.Error())
+			}
+			defer store.Close()
+			b, err := New(configs.Binance{Assets: []string{"USDT"}, Fiats: []string{"RUB"}})
+			if err != nil {
+				t.Fatalf("could not create binance: %s", err.Error())
+			}
+			b.UseLogger(discardLogger)
+			b.UseStorage(store)
+
+			for _, count := range tt.offers {
+				b.batchOffers(context.Background(), testOffers(make([]float64, count)...))
+			}
+			db, err := sql.Open("sqlite3", dsn)
+			if err != nil {
+				t.Fatalf("could not open the database: %s", err.Error())
+			}
+			defer db.Close()
+			var stored int
+			if err = db.QueryRow(`SELECT COUNT(*) FROM binance_ads`).Scan(&stored); err != nil {
+				t.Fatalf("could not count the stored ads: %s", err.Error())
+			}
+			if stored != tt.wantStored {
+				t.Errorf("got %d stored offers, want %d", stored, tt.wantStored)
+			}
+			if kept := len(b.stored); kept != tt.wantKept {
+				t.Errorf("got %d offers kept for the end of the scrape, want %d", kept, tt.wantKept)
+			}
+		})
+	}
+}
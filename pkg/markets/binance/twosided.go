@@ -0,0 +1,56 @@
+package binance
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+func init() {
+	prometheus.MustRegister(binanceTwoSidedAdvertisers)
+}
+
+var binanceTwoSidedAdvertisers = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "binance",
+		Name:      "two_sided_advertiser_count",
+		Help:      "Advertisers posting on both sides of a pair.",
+	},
+	pairLabels,
+)
+
+// observeTwoSided counts advertisers posting on every side of the pair,
+// with excludeTwoSided their offers are removed from the results
+func (b *Binance) observeTwoSided(options *models.BinanceRequest, results []*sideResult) {
+	sides := make(map[string]int)
+	for _, result := range results {
+		seen := make(map[string]bool)
+		for _, offer := range result.offers {
+			if offer.AdvertiserNo != "" && !seen[offer.AdvertiserNo] {
+				seen[offer.AdvertiserNo] = true
+				sides[offer.AdvertiserNo]++
+			}
+		}
+	}
+	twoSided := make(map[string]bool)
+	for advertiserNo, count := range sides {
+		if count == len(results) {
+			twoSided[advertiserNo] = true
+		}
+	}
+	if labels, keep := b.pairLabelsFor(options); keep {
+		binanceTwoSidedAdvertisers.WithLabelValues(labels...).Set(float64(len(twoSided)))
+	}
+
+	if !b.config.ExcludeTwoSided || len(twoSided) == 0 {
+		return
+	}
+	for _, result := range results {
+		offers := make([]models.Offer, 0, len(result.offers))
+		for _, offer := range result.offers {
+			if !twoSided[offer.AdvertiserNo] {
+				offers = append(offers, offer)
+			}
+		}
+		result.offers = offers
+	}
+}
@@ -0,0 +1,94 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/slvic/stock-observer/internal/configs"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// PairReport is the verify result of a single trade side of a pair
+type PairReport struct {
+	Pair   string
+	Offers int
+	Passed bool
+	Reason string
+}
+
+// Verify scrapes every configured pair once without exporting metrics
+// and checks the results against the thresholds
+func (b *Binance) Verify(ctx context.Context, cfg configs.Verify) []PairReport {
+	var (
+		mu      sync.Mutex
+		reports []PairReport
+	)
+	verifier, ctx := errgroup.WithContext(ctx)
+	verifier.SetLimit(b.config.MaxConcurrency)
+	for _, pair := range b.scheduledPairs() {
+		for _, options := range b.optionGroups(pair) {
+			for _, option := range options {
+				option := option
+				verifier.Go(func() error {
+					report := b.verifySide(ctx, &option, cfg)
+					mu.Lock()
+					reports = append(reports, report)
+					mu.Unlock()
+					return nil
+				})
+			}
+		}
+	}
+	_ = verifier.Wait()
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Pair < reports[j].Pair
+	})
+	return reports
+}
+
+func (b *Binance) verifySide(ctx context.Context, options *models.BinanceRequest, cfg configs.Verify) PairReport {
+	report := PairReport{Pair: marketKey(options)}
+	result, err := b.collect(ctx, options)
+	if err != nil {
+		report.Reason = fmt.Sprintf("could not get data: %s", err.Error())
+		return report
+	}
+	if result.dropped {
+		report.Passed = true
+		report.Reason = "dropped by relabel rules"
+		return report
+	}
+	report.Offers = len(result.offers)
+	if report.Offers < cfg.MinOffers {
+		report.Reason = fmt.Sprintf("got %d offers, want at least %d", report.Offers, cfg.MinOffers)
+		return report
+	}
+	for _, offer := range result.offers {
+		if cfg.MinPrice > 0 && offer.Price < cfg.MinPrice {
+			report.Reason = fmt.Sprintf("price %v is below %v", offer.Price, cfg.MinPrice)
+			return report
+		}
+		if cfg.MaxPrice > 0 && offer.Price > cfg.MaxPrice {
+			report.Reason = fmt.Sprintf("price %v is above %v", offer.Price, cfg.MaxPrice)
+			return report
+		}
+	}
+	report.Passed = true
+	return report
+}
+
+// Probe requests a single ad of the first scheduled pair
+func (b *Binance) Probe(ctx context.Context) error {
+	pairs := b.scheduledPairs()
+	if len(pairs) == 0 {
+		return fmt.Errorf("no pairs are configured")
+	}
+	options := getOptions(pairs[0].Asset, pairs[0].Fiat, 1, b.merchantChecks()[0], nil)[0]
+	if _, err := b.getResponse(ctx, &options); err != nil {
+		return fmt.Errorf("could not probe %s: %w", marketKey(&options), err)
+	}
+	return nil
+}
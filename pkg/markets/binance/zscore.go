@@ -0,0 +1,108 @@
+package binance
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slvic/stock-observer/pkg/markets/models"
+)
+
+const (
+	defaultZScoreWindow    = 100
+	defaultZScoreThreshold = 3
+	// the standard deviation of fewer samples than this is not trusted
+	minZScoreSamples = 10
+)
+
+func init() {
+	prometheus.MustRegister(binancePriceZScore)
+	prometheus.MustRegister(binancePriceAnomalies)
+}
+
+var (
+	binancePriceZScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "binance",
+			Name:      "price_zscore",
+			Help:      "Z-score of the best price against the recent scrapes.",
+		},
+		binanceLabels,
+	)
+	binancePriceAnomalies = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binance",
+			Name:      "price_anomalies_total",
+			Help:      "Scrapes whose best price z-score exceeded the threshold.",
+		},
+		binanceLabels,
+	)
+)
+
+// rollingStats keeps the last window samples, the mean and the standard
+// deviation are computed from them, running sums of squares lose the
+// variance of large prices that barely move
+type rollingStats struct {
+	values []float64
+	next   int
+	window int
+}
+
+func newRollingStats(window int) *rollingStats {
+	return &rollingStats{
+		values: make([]float64, 0, window),
+		window: window,
+	}
+}
+
+func (r *rollingStats) add(value float64) {
+	if len(r.values) == r.window {
+		r.values[r.next] = value
+		r.next = (r.next + 1) % r.window
+		return
+	}
+	r.values = append(r.values, value)
+}
+
+// zScore is not ok during the warm up and while the samples have no variance
+func (r *rollingStats) zScore(value float64) (float64, bool) {
+	if len(r.values) < minZScoreSamples {
+		return 0, false
+	}
+	n := float64(len(r.values))
+	var sum float64
+	for _, sample := range r.values {
+		sum += sample
+	}
+	mean := sum / n
+	var squares float64
+	for _, sample := range r.values {
+		squares += (sample - mean) * (sample - mean)
+	}
+	variance := squares / n
+	if variance <= 0 {
+		return 0, false
+	}
+	return (value - mean) / math.Sqrt(variance), true
+}
+
+// observeZScore compares the best price of the scrape against the previous ones,
+// offers must be sorted by best
+func (b *Binance) observeZScore(options *models.BinanceRequest, labels []string, offers []models.Offer) {
+	b.zScoreMu.Lock()
+	defer b.zScoreMu.Unlock()
+
+	key := marketKey(options)
+	stats, ok := b.zScores[key]
+	if !ok {
+		stats = newRollingStats(b.config.ZScoreWindow)
+		b.zScores[key] = stats
+	}
+	price := offers[0].Price
+	if zScore, ok := stats.zScore(price); ok {
+		binancePriceZScore.WithLabelValues(labels...).Set(zScore)
+		if math.Abs(zScore) > b.config.ZScoreThreshold {
+			binancePriceAnomalies.WithLabelValues(labels...).Inc()
+		}
+	}
+	stats.add(price)
+}
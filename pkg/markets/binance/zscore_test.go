@@ -0,0 +1,89 @@
+package binance
+
+import (
+	"math"
+	"testing"
+)
+
+// repeat returns count copies of the values one after another
+func repeat(count int, values ...float64) []float64 {
+	repeated := make([]float64, 0, count*len(values))
+	for i := 0; i < count; i++ {
+		repeated = append(repeated, values...)
+	}
+	return repeated
+}
+
+func TestRollingStatsZScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int
+		values []float64
+		price  float64
+		want   float64
+		wantOk bool
+	}{
+		{
+			name:   "warm up",
+			window: 100,
+			values: repeat(minZScoreSamples-1, 1),
+			price:  2,
+		},
+		{
+			name:   "no variance",
+			window: 100,
+			values: repeat(minZScoreSamples, 1),
+			price:  2,
+		},
+		{
+			name:   "mean price",
+			window: 100,
+			values: repeat(5, 1, 2),
+			price:  1.5,
+			want:   0,
+			wantOk: true,
+		},
+		{
+			name:   "two deviations",
+			window: 100,
+			values: repeat(5, 1, 2),
+			price:  2.5,
+			want:   2,
+			wantOk: true,
+		},
+		{
+			// large prices that barely move lose every digit of their variance
+			// in running sums of squares, more so with every eviction
+			name:   "large prices over many evictions",
+			window: 100,
+			values: append(repeat(1000, 5e7), repeat(50000, 1e7, 1e7+0.01)...),
+			price:  1e7 + 0.015,
+			want:   2,
+			wantOk: true,
+		},
+		{
+			name:   "old samples leave the window",
+			window: 10,
+			values: append(repeat(10, 1000), repeat(5, 1, 2)...),
+			price:  2.5,
+			want:   2,
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := newRollingStats(tt.window)
+			for _, value := range tt.values {
+				stats.add(value)
+			}
+
+			got, ok := stats.zScore(tt.price)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("got z-score %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,7 @@ type BinanceRequest struct {
 	Fiat          string   `json:"fiat"`
 	MerchantCheck bool     `json:"merchantCheck"`
 	Page          int32    `json:"page"`
-	PayTypes      []string `json:"-"`
+	PayTypes      []string `json:"payTypes,omitempty"`
 	PublisherType *string  `json:"publisherType"`
 	Rows          int32    `json:"rows"`
 	TradeType     string   `json:"tradeType"`
@@ -15,6 +15,7 @@ type BinanceResponse struct {
 	Code          *string `json:"code"`
 	Message       *string `json:"message"`
 	MessageDetail *string `json:"messageDetail"`
+	Success       *bool   `json:"success"`
 	Data          []Data  `json:"data"`
 }
 
@@ -106,7 +107,7 @@ type Advertiser struct {
 	MarginUnit       *string       `json:"marginUnit"`
 	OrderCount       *string       `json:"orderCount"`
 	MonthOrderCount  *int          `json:"monthOrderCount"`
-	MonthFinishRate  *float32      `json:"monthFinishRate"`
+	MonthFinishRate  *float64      `json:"monthFinishRate"`
 	AdvConfirmTime   *string       `json:"advConfirmTime"`
 	Email            *string       `json:"email"`
 	RegistrationTime *string       `json:"registrationTime"`
@@ -123,3 +124,34 @@ type ProMerchant struct {
 	MerchantLogo        *string `json:"merchantLogo"`
 	MerchantDescription *string `json:"merchantDescription"`
 }
+
+type BinanceConfigRequest struct {
+	Fiat string `json:"fiat"`
+}
+
+type BinanceConfigResponse struct {
+	Code *string    `json:"code"`
+	Data ConfigData `json:"data"`
+}
+
+type ConfigData struct {
+	Areas []Area `json:"areas"`
+}
+
+type Area struct {
+	Area       *string     `json:"area"`
+	TradeSides []TradeSide `json:"tradeSides"`
+}
+
+type TradeSide struct {
+	Side   *string       `json:"side"`
+	Assets []ConfigAsset `json:"assets"`
+}
+
+type ConfigAsset struct {
+	Asset *string `json:"asset"`
+}
+
+type BinanceServerTime struct {
+	ServerTime int64 `json:"serverTime"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Offer is a binance ad with its numeric fields parsed
+type Offer struct {
+	TradeType        string   `json:"tradeType"`
+	Asset            string   `json:"asset"`
+	Fiat             string   `json:"fiat"`
+	Price            float64  `json:"price"`
+	TradableQuantity float64  `json:"tradableQuantity"`
+	CommissionRate   float64  `json:"commissionRate"`
+	PayMethods       []string `json:"payMethods"`
+	AdvertiserNo     string   `json:"advertiserNo,omitempty"`
+	// nil when the ad does not carry the limit
+	MinTransAmount *float64 `json:"minTransAmount,omitempty"`
+	MaxTransAmount *float64 `json:"maxTransAmount,omitempty"`
+	// nil when the advertiser stats are missing
+	MonthOrderCount *int     `json:"monthOrderCount,omitempty"`
+	MonthFinishRate *float64 `json:"monthFinishRate,omitempty"`
+}
+
+// OfferSample is an offer with the time it was scraped at
+type OfferSample struct {
+	Time time.Time `json:"time"`
+	Offer
+}
@@ -0,0 +1,17 @@
+package markets
+
+import "context"
+
+// MarketSource is a market scraped once per fetch interval
+type MarketSource interface {
+	// Name is the market label of the source metrics
+	Name() string
+	// Collect scrapes the market once and exports its metrics
+	Collect(ctx context.Context) error
+}
+
+// Prober is a source that can check it is reachable without scraping
+type Prober interface {
+	// Probe sends a single request to the market
+	Probe(ctx context.Context) error
+}
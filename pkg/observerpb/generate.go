@@ -0,0 +1,5 @@
+// Package observerpb is the grpc api of the latest market data,
+// the code is generated from observer.proto with buf
+package observerpb
+
+//go:generate buf generate
@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: observer.proto
+
+package observerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Observer_GetLatest_FullMethodName = "/observer.v1.Observer/GetLatest"
+	Observer_Subscribe_FullMethodName = "/observer.v1.Observer/Subscribe"
+)
+
+// ObserverClient is the client API for Observer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ObserverClient interface {
+	// GetLatest returns the data of the latest scrape
+	GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*Latest, error)
+	// Subscribe sends the data of the latest scrape and then the data of every
+	// following scrape, a client slower than the scrapes only gets the newest
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Observer_SubscribeClient, error)
+}
+
+type observerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewObserverClient(cc grpc.ClientConnInterface) ObserverClient {
+	return &observerClient{cc}
+}
+
+func (c *observerClient) GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*Latest, error) {
+	out := new(Latest)
+	err := c.cc.Invoke(ctx, Observer_GetLatest_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *observerClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Observer_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Observer_ServiceDesc.Streams[0], Observer_Subscribe_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &observerSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Observer_SubscribeClient interface {
+	Recv() (*Latest, error)
+	grpc.ClientStream
+}
+
+type observerSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *observerSubscribeClient) Recv() (*Latest, error) {
+	m := new(Latest)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ObserverServer is the server API for Observer service.
+// All implementations must embed UnimplementedObserverServer
+// for forward compatibility
+type ObserverServer interface {
+	// GetLatest returns the data of the latest scrape
+	GetLatest(context.Context, *GetLatestRequest) (*Latest, error)
+	// Subscribe sends the data of the latest scrape and then the data of every
+	// following scrape, a client slower than the scrapes only gets the newest
+	Subscribe(*SubscribeRequest, Observer_SubscribeServer) error
+	mustEmbedUnimplementedObserverServer()
+}
+
+// UnimplementedObserverServer must be embedded to have forward compatible implementations.
+type UnimplementedObserverServer struct {
+}
+
+func (UnimplementedObserverServer) GetLatest(context.Context, *GetLatestRequest) (*Latest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatest not implemented")
+}
+func (UnimplementedObserverServer) Subscribe(*SubscribeRequest, Observer_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedObserverServer) mustEmbedUnimplementedObserverServer() {}
+
+// UnsafeObserverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ObserverServer will
+// result in compilation errors.
+type UnsafeObserverServer interface {
+	mustEmbedUnimplementedObserverServer()
+}
+
+func RegisterObserverServer(s grpc.ServiceRegistrar, srv ObserverServer) {
+	s.RegisterService(&Observer_ServiceDesc, srv)
+}
+
+func _Observer_GetLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObserverServer).GetLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Observer_GetLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObserverServer).GetLatest(ctx, req.(*GetLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Observer_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ObserverServer).Subscribe(m, &observerSubscribeServer{stream})
+}
+
+type Observer_SubscribeServer interface {
+	Send(*Latest) error
+	grpc.ServerStream
+}
+
+type observerSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *observerSubscribeServer) Send(m *Latest) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Observer_ServiceDesc is the grpc.ServiceDesc for Observer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Observer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "observer.v1.Observer",
+	HandlerType: (*ObserverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLatest",
+			Handler:    _Observer_GetLatest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Observer_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "observer.proto",
+}